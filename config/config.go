@@ -7,3 +7,57 @@ import (
 var DefaultRequest = 0
 var DefaultLimit = 3
 var DefaultWindow = 5 * time.Second
+var DefaultAlgorithm = "counter"
+var DefaultMaxInFlight = 0
+
+// Maximum number of request timestamps kept per client by the sliding log algorithm
+var MaxSlidingLogSize = 1000
+
+// Cost of a request when it is not defined by the route or header
+var DefaultCost = 1
+
+// Cost of a request per route, for example an expensive export can take more from the limit than a cheap read
+var RouteCost = map[string]int{}
+
+// Header containing the cost of a request, only used for routes without a route cost
+// The header is ignored unless it is trusted, which should only be done when it is set by an upstream service rather than the client
+var CostHeader = "requestCost"
+var TrustCostHeader = false
+
+// Also send the rate limit headers using the older X-RateLimit-* names, for clients that do not support the RateLimit-* headers
+var LegacyRateLimitHeaders = false
+
+// Log the usage of every request, which is useful for debugging but slow, as every log call takes the lock of the logger
+var LogRequests = false
+
+// Number of shards of the in memory store, each shard has its own lock so different clients can be checked in parallel
+var StoreShards = 64
+
+// Prefix of the keys used by the Redis store, the clientID is appended to it
+var RedisKeyPrefix = "rate_limiter:"
+
+// File the in memory store is saved to, so the rate limits survive a restart. Snapshots are disabled when empty
+var SnapshotPath = "snapshot.json"
+var SnapshotInterval = 10 * time.Second
+
+// Append-only log of every change since the last snapshot, replayed on startup. The log is compacted every snapshot interval
+// Each change is written before it is acknowledged, and synced to disk every sync interval. The log is disabled when empty
+var WALPath = "wal.log"
+var WALSyncInterval = time.Second
+
+// SQLite database keeping the config of every configured client, the request counts stay in memory. Disabled when empty
+var ConfigDBPath = "configs.db"
+
+// How often clients created from the default values are removed from the in memory store once all of their limits are refreshed
+var EvictionInterval = time.Minute
+
+// Maximum number of clients tracked by the in memory store, 0 means no limit
+// When the limit is reached, a new client is handled based on the policy:
+// "evict" removes the least recently used client created from the default values, "reject" rejects the new client,
+// and "overflow" counts the requests of every new client in a single shared bucket. Configured clients are never removed
+var MaxClients = 0
+var MaxClientsPolicy = "evict"
+
+// Check the limit of clients using the counter algorithm with atomic operations instead of a lock
+// The write-ahead log and max clients are not supported by this store, so only snapshots are used to persist it
+var AtomicCounterStore = false
@@ -1,40 +1,128 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"os/signal"
 	"rate_limiter/config"
+	"rate_limiter/redisstore"
+	"rate_limiter/snapshot"
+	"rate_limiter/sqlstore"
 	"rate_limiter/validator"
+	"rate_limiter/wal"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
+
+	"github.com/redis/go-redis/v9"
 )
 
 type Response struct {
-	Status  int    `json:"status"`
-	Message string `json:"message"`
+	Status    int    `json:"status"`
+	Message   string `json:"message"`
+	Remaining *int   `json:"remaining,omitempty"`
+	Limit     string `json:"limit,omitempty"`
 }
 
-// Do not change existing mocked data, as it might break the tests
-var mockedRateLimiterConfig = map[string]validator.RateLimiterData{
-	"PT A":    {Requests: 0, Limit: 3, Window: 5 * time.Second, FirstRequestTime: time.Now()},
-	"PT B":    {Requests: 0, Limit: 3, Window: 3 * time.Second, FirstRequestTime: time.Now()},
-	"PT TEST": {Requests: 0, Limit: 1, Window: 10 * time.Second, FirstRequestTime: time.Now()},
+type ConfigResponse struct {
+	Response
+	Config *ClientConfig `json:"config,omitempty"`
+}
+
+type ConfigListResponse struct {
+	Response
+	Configs  []ClientConfig `json:"configs"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"page_size"`
+	Total    int            `json:"total"`
+}
+
+// Problem is an error response following RFC 7807, used when the request body is invalid
+// The type is about:blank, so the title is the HTTP status text and the detail explains this occurrence of the problem
+type Problem struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+	// Every invalid field of the request, an extension member of the problem
+	Errors []validator.FieldError `json:"errors,omitempty"`
+}
+
+// StatusResponse is the status of every limit of a client as it is returned by GET /status
+// Remaining is the lowest remaining of all limits, and reset the time when every limit is fully available again
+type StatusResponse struct {
+	Response
+	Reset  *time.Time            `json:"reset,omitempty"`
+	Limits []LimitStatusResponse `json:"limits,omitempty"`
+}
+
+type LimitStatusResponse struct {
+	Name      string    `json:"name"`
+	Limit     int       `json:"limit"`
+	Used      int       `json:"used"`
+	Remaining int       `json:"remaining"`
+	Reset     time.Time `json:"reset"`
 }
 
-var rateLimiterData = validator.RateLimiterData{
-	Requests:         config.DefaultRequest,
-	Limit:            config.DefaultLimit,
-	Window:           config.DefaultWindow,
-	FirstRequestTime: time.Now(),
+// ClientConfig is the config of a client as it is returned by GET /config, using the same fields as the body of POST /config
+type ClientConfig struct {
+	ClientID string `json:"client_id"`
+	validator.CreateData
+	// False when the client uses the default values
+	Configured bool       `json:"configured"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
 }
-var rateLimiter = validator.RateLimiter{
-	RateLimiterData: rateLimiterData,
-	Mutex:           sync.Mutex{},
+
+func newClientConfig(clientID string, data validator.RateLimiterData) ClientConfig {
+	clientConfig := ClientConfig{ClientID: clientID, CreateData: data.Config(), Configured: data.Configured}
+	if !data.UpdatedAt.IsZero() {
+		clientConfig.UpdatedAt = &data.UpdatedAt
+	}
+	return clientConfig
 }
 
+// Number of configs returned per page by GET /config when listing every client
+const defaultPageSize = 20
+const maxPageSize = 100
+
+// Do not change existing mocked data, as it might break the tests
+var mockedRateLimiterConfig = map[string]validator.RateLimiterData{
+	"PT A": {
+		Policy: validator.Policy{Limit: 3, Window: 5 * time.Second, Configured: true},
+		Usage:  validator.Usage{Requests: 0, FirstRequestTime: time.Now()},
+	},
+	"PT B": {
+		Policy: validator.Policy{Limit: 3, Window: 3 * time.Second, Configured: true},
+		Usage:  validator.Usage{Requests: 0, FirstRequestTime: time.Now()},
+	},
+	"PT TEST": {
+		Policy: validator.Policy{Limit: 1, Window: 10 * time.Second, Configured: true},
+		Usage:  validator.Usage{Requests: 0, FirstRequestTime: time.Now()},
+	},
+}
+
+// All reads and writes of client data go through the store, which is seeded with the mocked data
+// The mocked clients are marked as configured, so they are not evicted once idle
+var memoryStore = validator.NewMemoryStore(mockedRateLimiterConfig)
+var rateLimiterStore validator.Store = memoryStore
+
+// Durable store of the client configs, nil when configs are only kept in the rate limiter store
+var configStore *sqlstore.ConfigStore
+
+// Only keeps the requests in flight, the data of every client is kept in the store
+var rateLimiter = validator.RateLimiter{}
+
 func main() {
 	// Idea is to have a centralized place to view logs, which in this case is done via a file
 	logFile, logErr := os.OpenFile("app.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
@@ -44,13 +132,137 @@ func main() {
 	defer logFile.Close()
 	log.SetOutput(logFile)
 
-	http.HandleFunc("/", requestHandler)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Use Redis to share the data between multiple instances, otherwise the data is kept in memory
+	// and persisted to disk, so the limits are not reset when the process restarts
+	shutdownStore := func() {}
+	if redisAddress := os.Getenv("REDIS_ADDR"); redisAddress != "" {
+		rateLimiterStore = redisstore.NewStore(redis.NewClient(&redis.Options{Addr: redisAddress}))
+	} else {
+		var evicter validator.Evicter = memoryStore
+		if config.AtomicCounterStore {
+			atomicStore := validator.NewAtomicCounterStore(mockedRateLimiterConfig)
+			rateLimiterStore, evicter = atomicStore, atomicStore
+		}
+
+		var err error
+		if config.SnapshotPath != "" {
+			if shutdownStore, err = persistStore(ctx); err != nil {
+				log.Fatal("Error restoring rate limiter data:", err)
+			}
+		}
+
+		go validator.RunEviction(ctx, evicter, config.EvictionInterval)
+
+		// Configs are restored last, as the database has the latest config of every client
+		if config.ConfigDBPath != "" {
+			if configStore, err = sqlstore.Open(config.ConfigDBPath); err != nil {
+				log.Fatal("Error opening config database:", err)
+			}
+			defer configStore.Close()
+			if _, err := configStore.Restore(rateLimiterStore, time.Now()); err != nil {
+				log.Fatal("Error restoring configs:", err)
+			}
+		}
+	}
+
+	http.HandleFunc("/", limitInFlight(requestHandler))
 	http.HandleFunc("/config", requestHandlerConfig)
+	http.HandleFunc("/config/", requestHandlerConfig)
+	http.HandleFunc("/status", statusHandler)
 
-	err := http.ListenAndServe(":8080", nil)
-	if err != nil {
+	server := &http.Server{Addr: ":8080"}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	err := server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatal("Error listening to port 8080:", err)
 	}
+
+	shutdownStore()
+}
+
+// Restore the in memory store from the latest snapshot and write-ahead log, and keep persisting it until the context is done
+// Returns a function that saves the store a last time, which is called on shutdown so no update is lost
+func persistStore(ctx context.Context) (func(), error) {
+	if _, err := snapshot.Restore(rateLimiterStore, config.SnapshotPath, time.Now()); err != nil {
+		return nil, err
+	}
+
+	// Every change written to the log goes through Update, which would bypass the lock-free counter of the atomic store
+	if config.WALPath == "" || config.AtomicCounterStore {
+		go snapshot.Run(ctx, rateLimiterStore, config.SnapshotPath, config.SnapshotInterval)
+		return func() {
+			if err := snapshot.Save(rateLimiterStore, config.SnapshotPath, time.Now()); err != nil {
+				log.Println("Error saving snapshot:", err)
+			}
+		}, nil
+	}
+
+	if _, err := wal.Replay(rateLimiterStore, config.WALPath, time.Now()); err != nil {
+		return nil, err
+	}
+	walStore, err := wal.Open(rateLimiterStore, config.WALPath)
+	if err != nil {
+		return nil, err
+	}
+	rateLimiterStore = walStore
+	go walStore.Run(ctx, config.SnapshotPath, config.WALSyncInterval, config.SnapshotInterval)
+	return func() {
+		if err := walStore.Compact(config.SnapshotPath, time.Now()); err != nil {
+			log.Println("Error compacting write-ahead log:", err)
+		}
+		walStore.Close()
+	}, nil
+}
+
+// Limit the number of requests a client can have in flight at once, based on the max in flight of the client config
+// The slot is released when the wrapped handler returns, which includes panics and client disconnects
+func limitInFlight(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clientID := r.Header.Get("clientID")
+		// Missing clientID is handled by the wrapped handler
+		if !validator.ValidateClientID(clientID) {
+			next(w, r)
+			return
+		}
+
+		acquired, err := rateLimiter.AcquireInFlight(clientID, rateLimiterStore)
+		if err != nil {
+			log.Println("Error acquiring in flight slot:", err)
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusInternalServerError)
+			json.NewEncoder(w).Encode(Response{Status: http.StatusInternalServerError, Message: "Internal server error"})
+			return
+		}
+
+		if !acquired {
+			// The limits are not used by the request, but are still described so the client can slow down
+			// A slot is available again as soon as another request of the client is done, which is not known in advance
+			currentTime := time.Now()
+			if rateLimiterCheck, err := rateLimiter.Peek(clientID, currentTime, rateLimiterStore); err == nil {
+				setRateLimitHeaders(w.Header(), rateLimiterCheck, currentTime)
+			}
+			w.Header().Set("Retry-After", "1")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			json.NewEncoder(w).Encode(Response{
+				Status:  http.StatusTooManyRequests,
+				Message: fmt.Sprintf("Too Many Concurrent Requests for %v", clientID),
+			})
+			return
+		}
+		defer rateLimiter.ReleaseInFlight(clientID)
+
+		next(w, r)
+	}
 }
 
 func requestHandler(w http.ResponseWriter, r *http.Request) {
@@ -69,59 +281,516 @@ func requestHandler(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(response)
 		return
 	}
-	rateLimiterCheck := rateLimiter.ValidateRequestLimit(clientID, currentTime, mockedRateLimiterConfig)
+
+	cost, ok := requestCost(r)
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		response.Status = http.StatusBadRequest
+		response.Message = "Request cost must be greater than 0"
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	rateLimiterCheck, err := rateLimiter.ValidateRequestLimitN(clientID, currentTime, cost, rateLimiterStore)
+	if err == nil && !rateLimiterCheck.Status && rateLimiterCheck.Data.MaxWait > 0 {
+		rateLimiterCheck, err = waitForRequestLimit(r.Context(), clientID, currentTime, cost, rateLimiterCheck)
+	}
+
+	// The store is full and does not accept new clients
+	if errors.Is(err, validator.ErrTooManyClients) {
+		log.Printf("Too many clients, rejecting %v\n", clientID)
+		w.WriteHeader(http.StatusServiceUnavailable)
+		response.Status = http.StatusServiceUnavailable
+		response.Message = "Too many clients, try again later"
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	// Too many other requests for the same client changed its data in Redis at the same time, the request can be retried
+	if errors.Is(err, redisstore.ErrConflict) {
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		response.Status = http.StatusServiceUnavailable
+		response.Message = "Too many concurrent requests for the client, try again later"
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+
+	if err != nil {
+		log.Println("Error validating request limit:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		response.Status = http.StatusInternalServerError
+		response.Message = "Internal server error"
+		json.NewEncoder(w).Encode(response)
+		return
+	}
+	response.Remaining = &rateLimiterCheck.Remaining
+	setRateLimitHeaders(w.Header(), rateLimiterCheck, time.Now())
 
 	if !rateLimiterCheck.Status {
 		w.WriteHeader(http.StatusTooManyRequests)
 		response.Status = http.StatusTooManyRequests
 		response.Message = fmt.Sprintf("Too Many Requests for %v", clientID)
-	} else {
-		mockedRateLimiterConfig[clientID] = rateLimiterCheck.Data
+		response.Limit = rateLimiterCheck.LimitName
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// Describe the limit of the client using the RateLimit-* headers, so a client can slow down before it is limited
+// RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset are all for the limit with the fewest units left, where the reset is
+// the number of seconds until that limit is fully available again. Retry-After is only sent when the request is limited
+func setRateLimitHeaders(header http.Header, rateLimiterCheck validator.RateLimitCheckResult, currentTime time.Time) {
+	limit := strconv.Itoa(rateLimiterCheck.Limit)
+	remaining := strconv.Itoa(rateLimiterCheck.Remaining)
+	reset := strconv.Itoa(ceilSeconds(rateLimiterCheck.LimitReset.Sub(currentTime)))
+	header.Set("RateLimit-Limit", limit)
+	header.Set("RateLimit-Remaining", remaining)
+	header.Set("RateLimit-Reset", reset)
+	header.Set("RateLimit-Policy", rateLimitPolicy(rateLimiterCheck.Data))
+
+	if config.LegacyRateLimitHeaders {
+		header.Set("X-RateLimit-Limit", limit)
+		header.Set("X-RateLimit-Remaining", remaining)
+		// The legacy reset is the time of the reset in seconds since epoch, rather than the number of seconds until the reset
+		header.Set("X-RateLimit-Reset", strconv.FormatInt(rateLimiterCheck.LimitReset.Unix(), 10))
+	}
+
+	if !rateLimiterCheck.Status {
+		// Retry after is unknown for some algorithms, in which case the client has to wait for the reset
+		retryAfter := rateLimiterCheck.RetryAfter
+		if retryAfter <= 0 {
+			retryAfter = rateLimiterCheck.Reset.Sub(currentTime)
+		}
+		header.Set("Retry-After", strconv.Itoa(max(ceilSeconds(retryAfter), 1)))
+	}
+}
+
+// Describe every limit of the client as <limit>;w=<window in seconds>, for example "3;w=5, 100;w=3600"
+// The window of a token bucket is the time it takes to refill the bucket when it is empty
+// A gcra limit with a burst is described by its burst, and the window is the time it takes to regain the whole burst
+func rateLimitPolicy(data validator.RateLimiterData) string {
+	policies := []string{}
+	for _, limit := range append([]validator.RateLimiterData{data}, data.Limits...) {
+		algorithm := limit.Algorithm
+		if algorithm == "" {
+			algorithm = config.DefaultAlgorithm
+		}
+		window := ceilSeconds(limit.Window)
+		if algorithm == validator.AlgorithmTokenBucket && limit.RefillPerSecond > 0 {
+			window = int(math.Ceil(float64(limit.Capacity) / limit.RefillPerSecond))
+		}
+		if algorithm == validator.AlgorithmGCRA && limit.Burst > 0 && limit.Limit > 0 {
+			window = ceilSeconds(limit.Window * time.Duration(limit.Burst) / time.Duration(limit.Limit))
+		}
+		policies = append(policies, fmt.Sprintf("%v;w=%v", limit.Size(), window))
+	}
+	return strings.Join(policies, ", ")
+}
+
+// Round the duration up to whole seconds, as the headers do not allow fractions of a second
+func ceilSeconds(duration time.Duration) int {
+	return max(int(math.Ceil(duration.Seconds())), 0)
+}
+
+// Delay the request until it is allowed by the rate limiter, instead of rejecting it right away
+// Waiting requests of a client are retried one at a time in the order they arrived, so they are released in order at the pace of the algorithm
+// The request is still rejected if the total wait would exceed the max wait of the client, or if the client disconnects
+func waitForRequestLimit(ctx context.Context, clientID string, startTime time.Time, cost int, rateLimiterCheck validator.RateLimitCheckResult) (validator.RateLimitCheckResult, error) {
+	deadline := startTime.Add(rateLimiterCheck.Data.MaxWait)
+	// Retry after is unknown for some algorithms, in which case we are not able to wait
+	if rateLimiterCheck.RetryAfter <= 0 || time.Now().Add(rateLimiterCheck.RetryAfter).After(deadline) {
+		return rateLimiterCheck, nil
+	}
+
+	queue := joinWaitQueue(clientID)
+	defer leaveWaitQueue(clientID, queue)
+	if !queue.wait(ctx, deadline) {
+		return rateLimiterCheck, nil
+	}
+	defer queue.done()
+
+	for {
+		var err error
+		rateLimiterCheck, err = rateLimiter.ValidateRequestLimitN(clientID, time.Now(), cost, rateLimiterStore)
+		if err != nil || rateLimiterCheck.Status {
+			return rateLimiterCheck, err
+		}
+
+		retryAfter := rateLimiterCheck.RetryAfter
+		if retryAfter <= 0 || time.Now().Add(retryAfter).After(deadline) {
+			return rateLimiterCheck, nil
+		}
+
+		log.Printf("Delaying request for %v by %v\n", clientID, retryAfter)
+		timer := time.NewTimer(retryAfter)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return rateLimiterCheck, nil
+		case <-timer.C:
+		}
+	}
+}
+
+// waitQueue lets the waiting requests of a client take turns
+// Requests blocked on sending to a channel are woken in the order they started waiting, which keeps the turns in order
+type waitQueue struct {
+	turn chan struct{}
+	// Number of requests using the queue, the queue is removed once it is 0
+	waiters int
+}
+
+var waitQueues = struct {
+	sync.Mutex
+	queues map[string]*waitQueue
+}{queues: map[string]*waitQueue{}}
+
+func joinWaitQueue(clientID string) *waitQueue {
+	waitQueues.Lock()
+	defer waitQueues.Unlock()
+
+	queue, ok := waitQueues.queues[clientID]
+	if !ok {
+		queue = &waitQueue{turn: make(chan struct{}, 1)}
+		waitQueues.queues[clientID] = queue
+	}
+	queue.waiters++
+	return queue
+}
+
+func leaveWaitQueue(clientID string, queue *waitQueue) {
+	waitQueues.Lock()
+	defer waitQueues.Unlock()
+
+	queue.waiters--
+	if queue.waiters == 0 {
+		delete(waitQueues.queues, clientID)
+	}
+}
+
+// wait blocks until it is the turn of the request, and returns false if the deadline passes or the client disconnects first
+func (queue *waitQueue) wait(ctx context.Context, deadline time.Time) bool {
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case queue.turn <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return false
+	}
+}
+
+// done ends the turn of the request, so the next waiting request is retried
+func (queue *waitQueue) done() {
+	<-queue.turn
+}
+
+// Get the cost of the request from the route, otherwise from the cost header if it is trusted
+// The route cost is used first, so the header can not lower the cost of an expensive route
+// Returns false if the cost in the header is invalid
+func requestCost(r *http.Request) (int, bool) {
+	if cost, ok := config.RouteCost[r.URL.Path]; ok {
+		return cost, true
+	}
+
+	header := r.Header.Get(config.CostHeader)
+	if !config.TrustCostHeader || header == "" {
+		return config.DefaultCost, true
+	}
+	cost, err := strconv.Atoi(header)
+	if err != nil {
+		return 0, false
+	}
+	return cost, validator.ValidateCost(cost)
+}
+
+// Get the status of every limit of the client, without using any of them
+// Not wrapped by limitInFlight, so a client can check its status even while it has the maximum number of requests in flight
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != "GET" {
+		writeResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+		return
+	}
+
+	clientID := r.Header.Get("clientID")
+	if !validator.ValidateClientID(clientID) {
+		writeResponse(w, http.StatusBadRequest, "No clientID provided")
+		return
+	}
+
+	statuses, err := rateLimiter.Status(clientID, time.Now(), rateLimiterStore)
+	if err != nil {
+		log.Println("Error getting status:", err)
+		writeResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	response := StatusResponse{
+		Response: Response{Status: http.StatusOK, Message: fmt.Sprintf("Status of %v", clientID)},
+	}
+	for i, status := range statuses {
+		if i == 0 || status.Remaining < *response.Remaining {
+			response.Remaining = &status.Remaining
+		}
+		if response.Reset == nil || status.Reset.After(*response.Reset) {
+			response.Reset = &status.Reset
+		}
+		response.Limits = append(response.Limits, LimitStatusResponse{
+			Name:      status.Name,
+			Limit:     status.Limit,
+			Used:      status.Used,
+			Remaining: status.Remaining,
+			Reset:     status.Reset,
+		})
 	}
 	json.NewEncoder(w).Encode(response)
 }
 
 func requestHandlerConfig(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	var response Response
 	switch r.Method {
-	// Current POST request will override any existing configuration
-	// For future improvement, will need to add validation for existing clients and only allow editing of existing clients using PATCH request
+	case "GET":
+		getConfig(w, r)
+	// Current POST request will override any existing configuration, keeping what the client has already used unless reset_usage is set
 	case "POST":
-		clientID := r.Header.Get("clientID")
-		var data validator.CreateData
-		json.NewDecoder(r.Body).Decode(&data)
+		createConfig(w, r)
+	// PATCH only changes the fields provided in the body, and only for clients that already have a config
+	case "PATCH":
+		patchConfig(w, r)
+	case "DELETE":
+		deleteConfig(w, r)
+	default:
+		writeResponse(w, http.StatusMethodNotAllowed, "Method not allowed")
+	}
+}
 
-		if !validator.ValidateClientID(clientID) {
-			w.WriteHeader(http.StatusBadRequest)
-			response.Status = http.StatusBadRequest
-			response.Message = "No clientID provided"
-			json.NewEncoder(w).Encode(response)
-			return
-		}
+// Get the clientID of a config request from the path (/config/<clientID>), otherwise from the header
+func configClientID(r *http.Request) string {
+	if clientID, ok := strings.CutPrefix(r.URL.Path, "/config/"); ok && clientID != "" {
+		return clientID
+	}
+	return r.Header.Get("clientID")
+}
 
-		// For future improvement, be more specific in the error message
-		// For example, if the body contains string, specify that the data type is incorrect
-		if !validator.ValidateConfig(data) {
-			w.WriteHeader(http.StatusBadRequest)
-			response.Status = http.StatusBadRequest
-			response.Message = "Config data must be greater than 0"
-			json.NewEncoder(w).Encode(response)
-			return
+// Get the config of a single client when a clientID is provided, otherwise a page of the configs of every client
+func getConfig(w http.ResponseWriter, r *http.Request) {
+	clientID := configClientID(r)
+	if !validator.ValidateClientID(clientID) {
+		listConfigs(w, r)
+		return
+	}
+
+	clientData, ok, err := rateLimiterStore.Get(clientID)
+	if err != nil {
+		log.Println("Error getting config:", err)
+		writeResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if !ok {
+		writeResponse(w, http.StatusNotFound, fmt.Sprintf("Config not found for %v", clientID))
+		return
+	}
+
+	clientConfig := newClientConfig(clientID, clientData)
+	json.NewEncoder(w).Encode(ConfigResponse{
+		Response: Response{Status: http.StatusOK, Message: fmt.Sprintf("Config for %v", clientID)},
+		Config:   &clientConfig,
+	})
+}
+
+// List the configs of every client sorted by clientID, one page at a time
+// The list can be filtered by clientID prefix, algorithm, and whether the client has a config or uses the default values
+func listConfigs(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	page, pageErr := queryInt(query.Get("page"), 1)
+	pageSize, pageSizeErr := queryInt(query.Get("page_size"), defaultPageSize)
+	if pageErr != nil || pageSizeErr != nil || page < 1 || pageSize < 1 || pageSize > maxPageSize {
+		writeResponse(w, http.StatusBadRequest, fmt.Sprintf("page must be greater than 0 and page_size must be between 1 and %v", maxPageSize))
+		return
+	}
+
+	clients, err := rateLimiterStore.List()
+	if err != nil {
+		log.Println("Error listing configs:", err)
+		writeResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+
+	configs := []ClientConfig{}
+	for clientID, clientData := range clients {
+		// The overflow bucket is not a client
+		if !validator.ValidateClientID(clientID) || !strings.HasPrefix(clientID, query.Get("prefix")) {
+			continue
+		}
+		if algorithm := query.Get("algorithm"); algorithm != "" && clientData.Algorithm != algorithm &&
+			!(algorithm == config.DefaultAlgorithm && clientData.Algorithm == "") {
+			continue
 		}
+		if configured := query.Get("configured"); configured != "" && configured != strconv.FormatBool(clientData.Configured) {
+			continue
+		}
+		configs = append(configs, newClientConfig(clientID, clientData))
+	}
+	sort.Slice(configs, func(i, j int) bool { return configs[i].ClientID < configs[j].ClientID })
 
+	response := ConfigListResponse{
+		Response: Response{Status: http.StatusOK, Message: "Configs"},
+		Configs:  []ClientConfig{},
+		Page:     page,
+		PageSize: pageSize,
+		Total:    len(configs),
+	}
+	if start := (page - 1) * pageSize; start < len(configs) {
+		response.Configs = configs[start:min(start+pageSize, len(configs))]
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// Parse an integer query parameter, using the default value when it is not provided
+func queryInt(value string, defaultValue int) (int, error) {
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func createConfig(w http.ResponseWriter, r *http.Request) {
+	clientID := configClientID(r)
+	if !validator.ValidateClientID(clientID) {
+		writeResponse(w, http.StatusBadRequest, "No clientID provided")
+		return
+	}
+
+	var data validator.CreateData
+	if !decodeConfig(w, r, &data, validator.DecodeConfig) {
+		return
+	}
+
+	if err := saveConfig(clientID, data); err != nil {
+		log.Println("Error creating config:", err)
+		writeResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	writeResponse(w, http.StatusOK, fmt.Sprintf("New config created for %v", clientID))
+}
+
+func patchConfig(w http.ResponseWriter, r *http.Request) {
+	clientID := configClientID(r)
+	if !validator.ValidateClientID(clientID) {
+		writeResponse(w, http.StatusBadRequest, "No clientID provided")
+		return
+	}
+
+	clientData, ok, err := rateLimiterStore.Get(clientID)
+	if err != nil {
+		log.Println("Error getting config:", err)
+		writeResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	if !ok || !clientData.Configured {
+		writeResponse(w, http.StatusNotFound, fmt.Sprintf("Config not found for %v", clientID))
+		return
+	}
+
+	// Only the fields in the body replace the current config, the metadata and additional limits are replaced as a whole
+	data := clientData.Config()
+	if !decodeConfig(w, r, &data, validator.PatchConfig) {
+		return
+	}
+
+	if err := saveConfig(clientID, data); err != nil {
+		log.Println("Error updating config:", err)
+		writeResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	writeResponse(w, http.StatusOK, fmt.Sprintf("Config updated for %v", clientID))
+}
+
+// Delete the config of the client, so the default values are used again
+func deleteConfig(w http.ResponseWriter, r *http.Request) {
+	clientID := configClientID(r)
+	if !validator.ValidateClientID(clientID) {
+		writeResponse(w, http.StatusBadRequest, "No clientID provided")
+		return
+	}
+
+	// A client only using the default values has no config to delete, the same as patchConfig
+	clientData, ok, err := rateLimiterStore.Get(clientID)
+	if err == nil && (!ok || !clientData.Configured) {
+		writeResponse(w, http.StatusNotFound, fmt.Sprintf("Config not found for %v", clientID))
+		return
+	}
+
+	if err == nil && configStore != nil {
+		err = configStore.Delete(clientID)
+	}
+	if err == nil {
 		currentTime := time.Now()
-		mockedRateLimiterConfig[clientID] = validator.RateLimiterData{
-			Requests: 0, Limit: data.Limit, Window: time.Duration(data.Window) * time.Second, FirstRequestTime: currentTime,
-		}
+		err = rateLimiterStore.Update(clientID, func(clientData validator.RateLimiterData, ok bool) validator.RateLimiterData {
+			return validator.RevertToDefault(clientData, currentTime)
+		})
+	}
+	if err != nil {
+		log.Println("Error deleting config:", err)
+		writeResponse(w, http.StatusInternalServerError, "Internal server error")
+		return
+	}
+	writeResponse(w, http.StatusOK, fmt.Sprintf("Config deleted for %v, using default config", clientID))
+}
 
-		response.Status = http.StatusOK
-		response.Message = fmt.Sprintf("New config created for %v", clientID)
-	default:
-		w.WriteHeader(http.StatusMethodNotAllowed)
-		response.Status = http.StatusMethodNotAllowed
-		response.Message = "Method not allowed"
+// Decode the config from the body using decode and check it is valid before it is saved
+// Returns false once a problem listing every invalid field has been sent
+func decodeConfig(w http.ResponseWriter, r *http.Request, data *validator.CreateData, decode func(io.Reader, *validator.CreateData) []validator.FieldError) bool {
+	if errs := decode(r.Body, data); len(errs) > 0 {
+		writeProblem(w, r, http.StatusBadRequest, "Request body is not a valid config", errs)
+		return false
 	}
 
-	json.NewEncoder(w).Encode(response)
+	*data = data.ApplyRate()
+	if errs := validator.ConfigErrors(*data); len(errs) > 0 {
+		writeProblem(w, r, http.StatusBadRequest, "Config is invalid", errs)
+		return false
+	}
+	return true
+}
+
+// Save the config of the client, keeping what the client has already used unless reset_usage is set
+// The config is saved to the database first, so a config that was acknowledged is never lost
+func saveConfig(clientID string, data validator.CreateData) error {
+	currentTime := time.Now()
+	if configStore != nil {
+		if err := configStore.Save(clientID, data, currentTime); err != nil {
+			return err
+		}
+	}
+
+	return rateLimiterStore.Update(clientID, func(clientData validator.RateLimiterData, ok bool) validator.RateLimiterData {
+		// What the client has already used is kept, so changing the config does not let the client call the API again right away
+		if !ok || data.ResetUsage {
+			return validator.NewRateLimiterData(data, currentTime)
+		}
+		return validator.UpdateRateLimiterData(clientData, data, currentTime)
+	})
+}
+
+func writeResponse(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Response{Status: status, Message: message})
+}
+
+// Send an error as a problem following RFC 7807, with the invalid fields of the request
+func writeProblem(w http.ResponseWriter, r *http.Request, status int, detail string, errs []validator.FieldError) {
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(Problem{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+		Errors:   errs,
+	})
 }
@@ -7,7 +7,15 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"rate_limiter/config"
+	"rate_limiter/redisstore"
+	"rate_limiter/sqlstore"
+	"rate_limiter/validator"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -156,7 +164,7 @@ func TestRequestHandlerConfigFail(t *testing.T) {
 		expectedStatus := http.StatusMethodNotAllowed
 		expectedMessage := "Method not allowed"
 
-		request := httptest.NewRequest(http.MethodGet, "/config", nil)
+		request := httptest.NewRequest(http.MethodPut, "/config", nil)
 		response := httptest.NewRecorder()
 		requestHandlerConfig(response, request)
 		var body Body
@@ -191,124 +199,912 @@ func TestRequestHandlerConfigFail(t *testing.T) {
 	})
 
 	t.Run("no body provided", func(t *testing.T) {
-		expectedStatus := http.StatusBadRequest
-		expectedMessage := "Config data must be greater than 0"
+		expectProblem(t, `POST`, "", []validator.FieldError{
+			{Reason: validator.ReasonMalformedJSON},
+		})
+	})
 
-		request := httptest.NewRequest(http.MethodPost, "/config", nil)
-		request.Header.Set("clientID", "PT A")
+	t.Run("body contains string", func(t *testing.T) {
+		expectProblem(t, `POST`, `{
+			"limit": "10",
+			"window": "1"
+		}`, []validator.FieldError{
+			{Field: "limit", Reason: validator.ReasonWrongType},
+			{Field: "window", Reason: validator.ReasonWrongType},
+		})
+	})
+
+	t.Run("body contains array", func(t *testing.T) {
+		expectProblem(t, `POST`, `{
+			"limit": [10],
+			"window": [1]
+		}`, []validator.FieldError{
+			{Field: "limit", Reason: validator.ReasonWrongType},
+			{Field: "window", Reason: validator.ReasonWrongType},
+		})
+	})
+
+	t.Run("body contains struct", func(t *testing.T) {
+		expectProblem(t, `POST`, `{
+			"limit": {},
+			"window": {}
+		}`, []validator.FieldError{
+			{Field: "limit", Reason: validator.ReasonWrongType},
+			{Field: "window", Reason: validator.ReasonWrongType},
+		})
+	})
+
+	t.Run("unknown algorithm", func(t *testing.T) {
+		expectProblem(t, `POST`, `{
+			"limit": 10,
+			"window": 1,
+			"algorithm": "unknown"
+		}`, []validator.FieldError{
+			{Field: "algorithm", Reason: validator.ReasonInvalidValue},
+		})
+	})
+
+	t.Run("out of range", func(t *testing.T) {
+		expectProblem(t, `POST`, `{
+			"limit": 0,
+			"window": "-1s",
+			"limits": [{"algorithm": "token_bucket", "capacity": 10}]
+		}`, []validator.FieldError{
+			{Field: "limit", Reason: validator.ReasonOutOfRange},
+			{Field: "window", Reason: validator.ReasonOutOfRange},
+			{Field: "limits[0].refill_per_second", Reason: validator.ReasonOutOfRange},
+		})
+	})
+
+	t.Run("unknown field", func(t *testing.T) {
+		expectProblem(t, `POST`, `{
+			"limit": 10,
+			"window": 1,
+			"limits": [{"limit": 100, "windw": 60}]
+		}`, []validator.FieldError{
+			{Field: "limits[0].windw", Reason: validator.ReasonUnknownField},
+		})
+	})
+
+	t.Run("malformed JSON", func(t *testing.T) {
+		expectProblem(t, `POST`, `{"limit": 10, "window": 1`, []validator.FieldError{
+			{Reason: validator.ReasonMalformedJSON},
+		})
+	})
+
+	t.Run("trailing data", func(t *testing.T) {
+		expectProblem(t, `PATCH`, `{"limit": 10} {"limit": 20}`, []validator.FieldError{
+			{Reason: validator.ReasonMalformedJSON},
+		})
+	})
+}
+
+type ProblemBody struct {
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+	Errors   []validator.FieldError
+}
+
+// expectProblem sends the body as the config of PT A, and checks the problem returned lists the expected errors
+func expectProblem(t *testing.T, method string, requestBody string, expectedErrors []validator.FieldError) {
+	t.Helper()
+	expectedStatus := http.StatusBadRequest
+	expectedContentType := "application/problem+json"
+
+	request := httptest.NewRequest(method, "/config", strings.NewReader(requestBody))
+	request.Header.Set("clientID", "PT A")
+	response := httptest.NewRecorder()
+	requestHandlerConfig(response, request)
+	var body ProblemBody
+	json.Unmarshal(response.Body.Bytes(), &body)
+
+	if response.Code != expectedStatus || body.Status != expectedStatus {
+		t.Errorf("Expect status to be %v, but got %v", expectedStatus, body.Status)
+	}
+
+	if contentType := response.Header().Get("Content-Type"); contentType != expectedContentType {
+		t.Errorf("Expect content type to be %v, but got %v", expectedContentType, contentType)
+	}
+
+	if body.Type != "about:blank" || body.Title != http.StatusText(expectedStatus) || body.Instance != "/config" {
+		t.Errorf("Expect problem to be %v, but got %v", http.StatusText(expectedStatus), body)
+	}
+
+	if len(body.Errors) != len(expectedErrors) {
+		t.Fatalf("Expect errors to be %v, but got %v", expectedErrors, body.Errors)
+	}
+	for i, expected := range expectedErrors {
+		if body.Errors[i].Field != expected.Field || body.Errors[i].Reason != expected.Reason || body.Errors[i].Message == "" {
+			t.Errorf("Expect error to be %v, but got %v", expected, body.Errors[i])
+		}
+	}
+}
+
+type CostBody struct {
+	Status    int
+	Message   string
+	Remaining int
+}
+
+func TestRequestHandlerCost(t *testing.T) {
+	trustCostHeader := func() {
+		config.TrustCostHeader = true
+		t.Cleanup(func() { config.TrustCostHeader = false })
+	}
+
+	t.Run("cost from header", func(t *testing.T) {
+		trustCostHeader()
+		clientID := "PT Cost Header"
+		request := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(`{"limit": 10, "window": 10}`))
+		request.Header.Set("clientID", clientID)
+		requestHandlerConfig(httptest.NewRecorder(), request)
+
+		request = httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("clientID", clientID)
+		request.Header.Set(config.CostHeader, "6")
+		for _, expected := range []CostBody{
+			{Status: http.StatusOK, Remaining: 4},
+			{Status: http.StatusTooManyRequests, Remaining: 4},
+		} {
+			response := httptest.NewRecorder()
+			requestHandler(response, request)
+			var body CostBody
+			json.Unmarshal(response.Body.Bytes(), &body)
+
+			if body.Status != expected.Status {
+				t.Errorf("Expect status to be %v, but got %v", expected.Status, body.Status)
+			}
+
+			if body.Remaining != expected.Remaining {
+				t.Errorf("Expect remaining to be %v, but got %v", expected.Remaining, body.Remaining)
+			}
+		}
+	})
+
+	t.Run("cost from route", func(t *testing.T) {
+		clientID := "PT Cost Route"
+		config.RouteCost["/export"] = 3
+		defer delete(config.RouteCost, "/export")
+		expectedStatus := http.StatusOK
+		expectedRemaining := config.DefaultLimit - 3
+
+		request := httptest.NewRequest(http.MethodGet, "/export", nil)
+		request.Header.Set("clientID", clientID)
 		response := httptest.NewRecorder()
-		requestHandlerConfig(response, request)
-		var body Body
+		requestHandler(response, request)
+		var body CostBody
 		json.Unmarshal(response.Body.Bytes(), &body)
 
 		if body.Status != expectedStatus {
 			t.Errorf("Expect status to be %v, but got %v", expectedStatus, body.Status)
 		}
 
-		if body.Message != expectedMessage {
-			t.Errorf("Expect message to be %v, but got %v", expectedMessage, body.Message)
+		if body.Remaining != expectedRemaining {
+			t.Errorf("Expect remaining to be %v, but got %v", expectedRemaining, body.Remaining)
 		}
 	})
 
-	t.Run("body contains string", func(t *testing.T) {
-		clientID := "PT A"
+	t.Run("header can not lower the cost of a route", func(t *testing.T) {
+		config.RouteCost["/export"] = 3
+		defer delete(config.RouteCost, "/export")
+		expectedRemaining := config.DefaultLimit - 3
+
+		for _, trusted := range []bool{false, true} {
+			config.TrustCostHeader = trusted
+			request := httptest.NewRequest(http.MethodGet, "/export", nil)
+			request.Header.Set("clientID", fmt.Sprintf("PT Cost Route Header %v", trusted))
+			request.Header.Set(config.CostHeader, "1")
+			response := httptest.NewRecorder()
+			requestHandler(response, request)
+			var body CostBody
+			json.Unmarshal(response.Body.Bytes(), &body)
+
+			if body.Remaining != expectedRemaining {
+				t.Errorf("Expect remaining to be %v, but got %v", expectedRemaining, body.Remaining)
+			}
+		}
+		config.TrustCostHeader = false
+	})
+
+	t.Run("untrusted header is ignored", func(t *testing.T) {
+		expectedRemaining := config.DefaultLimit - 1
+
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("clientID", "PT Cost Untrusted")
+		request.Header.Set(config.CostHeader, "3")
+		response := httptest.NewRecorder()
+		requestHandler(response, request)
+		var body CostBody
+		json.Unmarshal(response.Body.Bytes(), &body)
+
+		if body.Remaining != expectedRemaining {
+			t.Errorf("Expect remaining to be %v, but got %v", expectedRemaining, body.Remaining)
+		}
+	})
+
+	t.Run("invalid cost", func(t *testing.T) {
+		trustCostHeader()
 		expectedStatus := http.StatusBadRequest
-		expectedMessage := "Config data must be greater than 0"
-		requestBody := strings.NewReader(`{
-			"limit": "10",
-			"window": "1"
-		}`)
+		expectedMessage := "Request cost must be greater than 0"
+
+		for _, cost := range []string{"0", "abc"} {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("clientID", "PT Cost Invalid")
+			request.Header.Set(config.CostHeader, cost)
+			response := httptest.NewRecorder()
+			requestHandler(response, request)
+			var body Body
+			json.Unmarshal(response.Body.Bytes(), &body)
+
+			if body.Status != expectedStatus {
+				t.Errorf("Expect status to be %v, but got %v", expectedStatus, body.Status)
+			}
+
+			if body.Message != expectedMessage {
+				t.Errorf("Expect message to be %v, but got %v", expectedMessage, body.Message)
+			}
+		}
+	})
+}
+
+type LimitBody struct {
+	Status  int
+	Message string
+	Limit   string
+}
 
-		request := httptest.NewRequest(http.MethodPost, "/config", requestBody)
+func TestRequestHandlerMultipleLimits(t *testing.T) {
+	t.Run("limit reached is named in the response", func(t *testing.T) {
+		clientID := "PT Multiple Limits"
+		expectedStatus := http.StatusTooManyRequests
+		expectedLimit := "daily quota"
+		request := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(`{
+			"limit": 10,
+			"window": 1,
+			"limits": [{"name": "daily quota", "limit": 2, "window": 86400}]
+		}`))
 		request.Header.Set("clientID", clientID)
+		requestHandlerConfig(httptest.NewRecorder(), request)
+
+		request = httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("clientID", clientID)
+		requestHandler(httptest.NewRecorder(), request)
+		requestHandler(httptest.NewRecorder(), request)
 		response := httptest.NewRecorder()
-		requestHandlerConfig(response, request)
-		var body Body
+		requestHandler(response, request)
+		var body LimitBody
 		json.Unmarshal(response.Body.Bytes(), &body)
 
 		if body.Status != expectedStatus {
 			t.Errorf("Expect status to be %v, but got %v", expectedStatus, body.Status)
 		}
 
-		if body.Message != expectedMessage {
-			t.Errorf("Expect message to be %v, but got %v", expectedMessage, body.Message)
+		if body.Limit != expectedLimit {
+			t.Errorf("Expect limit to be %v, but got %v", expectedLimit, body.Limit)
 		}
 	})
+}
 
-	t.Run("body contains array", func(t *testing.T) {
-		clientID := "PT A"
-		expectedStatus := http.StatusBadRequest
-		expectedMessage := "Config data must be greater than 0"
-		requestBody := strings.NewReader(`{
-			"limit": [10],
-			"window": [1]
-		}`)
+func TestConcurrentRequestAndConfig(t *testing.T) {
+	t.Run("config can be changed while requests are made", func(t *testing.T) {
+		clientID := "PT Concurrent"
+		var wg sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				request := httptest.NewRequest(http.MethodGet, "/", nil)
+				request.Header.Set("clientID", clientID)
+				limitInFlight(requestHandler)(httptest.NewRecorder(), request)
+			}()
+			go func() {
+				defer wg.Done()
+				request := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(`{"limit": 100, "window": 1}`))
+				request.Header.Set("clientID", clientID)
+				requestHandlerConfig(httptest.NewRecorder(), request)
+			}()
+		}
+		wg.Wait()
+
+		if _, ok, _ := rateLimiterStore.Get(clientID); !ok {
+			t.Errorf("Expect client to exist in the store")
+		}
+	})
+}
+
+func TestRequestHandlerConfigDatabase(t *testing.T) {
+	t.Run("config is saved to the database", func(t *testing.T) {
+		store, err := sqlstore.Open(filepath.Join(t.TempDir(), "configs.db"))
+		if err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
+		configStore = store
+		defer func() {
+			configStore = nil
+			store.Close()
+		}()
+
+		clientID := "PT Database"
+		request := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(`{"limit": 7, "window": 60, "metadata": {"team": "search"}}`))
+		request.Header.Set("clientID", clientID)
+		requestHandlerConfig(httptest.NewRecorder(), request)
+
+		config, ok, err := store.Get(clientID)
+		if err != nil || !ok {
+			t.Fatalf("Expect config to be saved, but got %v and %v", ok, err)
+		}
+
+		if config.Data.Limit != 7 || config.Data.Metadata["team"] != "search" {
+			t.Errorf("Expect saved config to have limit %v and metadata, but got %v", 7, config.Data)
+		}
+	})
+}
+
+func TestRequestHandlerTooManyClients(t *testing.T) {
+	t.Run("new client is rejected when the store is full", func(t *testing.T) {
+		store := rateLimiterStore
+		rateLimiterStore = validator.NewBoundedMemoryStore(nil, 1, 1, validator.MaxClientsPolicyReject)
+		defer func() { rateLimiterStore = store }()
+
+		expectedStatus := http.StatusServiceUnavailable
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("clientID", "PT Tracked")
+		requestHandler(httptest.NewRecorder(), request)
+
+		request.Header.Set("clientID", "PT Untracked")
+		response := httptest.NewRecorder()
+		requestHandler(response, request)
 
-		request := httptest.NewRequest(http.MethodPost, "/config", requestBody)
+		if response.Code != expectedStatus {
+			t.Errorf("Expect status to be %v, but got %v", expectedStatus, response.Code)
+		}
+	})
+}
+
+func TestRequestHandlerConfigUsage(t *testing.T) {
+	postConfig := func(clientID string, body string) {
+		request := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(body))
+		request.Header.Set("clientID", clientID)
+		requestHandlerConfig(httptest.NewRecorder(), request)
+	}
+	requestStatus := func(clientID string) int {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
 		request.Header.Set("clientID", clientID)
 		response := httptest.NewRecorder()
+		requestHandler(response, request)
+		return response.Code
+	}
+
+	t.Run("usage is kept when the config changes", func(t *testing.T) {
+		clientID := "PT Keep Usage"
+		postConfig(clientID, `{"limit": 2, "window": 60}`)
+		requestStatus(clientID)
+		requestStatus(clientID)
+		postConfig(clientID, `{"limit": 3, "window": 60}`)
+
+		for _, expected := range []int{http.StatusOK, http.StatusTooManyRequests} {
+			if status := requestStatus(clientID); status != expected {
+				t.Errorf("Expect status to be %v, but got %v", expected, status)
+			}
+		}
+	})
+
+	t.Run("usage is reset when requested", func(t *testing.T) {
+		clientID := "PT Reset Usage"
+		postConfig(clientID, `{"limit": 2, "window": 60}`)
+		requestStatus(clientID)
+		requestStatus(clientID)
+		postConfig(clientID, `{"limit": 2, "window": 60, "reset_usage": true}`)
+
+		for _, expected := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+			if status := requestStatus(clientID); status != expected {
+				t.Errorf("Expect status to be %v, but got %v", expected, status)
+			}
+		}
+	})
+}
+
+func TestRequestHandlerConfigCRUD(t *testing.T) {
+	configRequest := func(method string, target string, clientID string, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(method, target, strings.NewReader(body))
+		if clientID != "" {
+			request.Header.Set("clientID", clientID)
+		}
+		response := httptest.NewRecorder()
 		requestHandlerConfig(response, request)
-		var body Body
+		return response
+	}
+	configRequest(http.MethodPost, "/config", "PT CRUD A", `{"limit": 10, "window": 60, "metadata": {"team": "search"}}`)
+	configRequest(http.MethodPost, "/config", "PT CRUD B", `{"algorithm": "gcra", "limit": 5, "window": 10}`)
+	configRequest(http.MethodPost, "/config", "PT CRUD C", `{"limit": 1, "window": 1}`)
+
+	t.Run("get config by header and path", func(t *testing.T) {
+		for _, response := range []*httptest.ResponseRecorder{
+			configRequest(http.MethodGet, "/config", "PT CRUD A", ""),
+			configRequest(http.MethodGet, "/config/PT%20CRUD%20A", "", ""),
+		} {
+			var body ConfigResponse
+			json.Unmarshal(response.Body.Bytes(), &body)
+
+			if body.Status != http.StatusOK || body.Config == nil {
+				t.Fatalf("Expect config to be returned, but got %v", response.Body.String())
+			}
+
+			if body.Config.ClientID != "PT CRUD A" || body.Config.Limit != 10 || body.Config.Window != 60 || body.Config.Metadata["team"] != "search" {
+				t.Errorf("Expect config of %v, but got %+v", "PT CRUD A", body.Config)
+			}
+		}
+	})
+
+	t.Run("get unknown config", func(t *testing.T) {
+		response := configRequest(http.MethodGet, "/config/PT%20Unknown", "", "")
+
+		if response.Code != http.StatusNotFound {
+			t.Errorf("Expect status to be %v, but got %v", http.StatusNotFound, response.Code)
+		}
+	})
+
+	t.Run("list configs with filter and pagination", func(t *testing.T) {
+		response := configRequest(http.MethodGet, "/config?prefix=PT%20CRUD&page_size=2&page=1", "", "")
+		var body ConfigListResponse
 		json.Unmarshal(response.Body.Bytes(), &body)
 
-		if body.Status != expectedStatus {
-			t.Errorf("Expect status to be %v, but got %v", expectedStatus, body.Status)
+		if body.Total != 3 || len(body.Configs) != 2 || body.Configs[0].ClientID != "PT CRUD A" || body.Configs[1].ClientID != "PT CRUD B" {
+			t.Errorf("Expect first page of %v configs, but got %+v", 3, body)
 		}
 
-		if body.Message != expectedMessage {
-			t.Errorf("Expect message to be %v, but got %v", expectedMessage, body.Message)
+		response = configRequest(http.MethodGet, "/config?prefix=PT%20CRUD&page_size=2&page=2", "", "")
+		json.Unmarshal(response.Body.Bytes(), &body)
+		if len(body.Configs) != 1 || body.Configs[0].ClientID != "PT CRUD C" {
+			t.Errorf("Expect second page with %v, but got %+v", "PT CRUD C", body.Configs)
+		}
+
+		response = configRequest(http.MethodGet, "/config?prefix=PT%20CRUD&algorithm=gcra", "", "")
+		json.Unmarshal(response.Body.Bytes(), &body)
+		if body.Total != 1 || body.Configs[0].ClientID != "PT CRUD B" {
+			t.Errorf("Expect only the gcra config, but got %+v", body.Configs)
 		}
 	})
 
-	t.Run("body contains struct", func(t *testing.T) {
-		clientID := "PT A"
-		expectedStatus := http.StatusBadRequest
-		expectedMessage := "Config data must be greater than 0"
-		requestBody := strings.NewReader(`{
-			"limit": {},
-			"window": {}
-		}`)
+	t.Run("invalid page", func(t *testing.T) {
+		response := configRequest(http.MethodGet, "/config?page=0", "", "")
+
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("Expect status to be %v, but got %v", http.StatusBadRequest, response.Code)
+		}
+	})
+
+	t.Run("patch only changes the fields provided", func(t *testing.T) {
+		response := configRequest(http.MethodPatch, "/config/PT%20CRUD%20A", "", `{"limit": 20}`)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expect status to be %v, but got %v", http.StatusOK, response.Code)
+		}
+
+		clientData, _, _ := rateLimiterStore.Get("PT CRUD A")
+		if clientData.Limit != 20 || clientData.Window != 60*time.Second || clientData.Metadata["team"] != "search" {
+			t.Errorf("Expect limit to be changed to %v and the rest to be kept, but got %+v", 20, clientData)
+		}
+	})
+
+	t.Run("patch invalid config", func(t *testing.T) {
+		response := configRequest(http.MethodPatch, "/config/PT%20CRUD%20A", "", `{"window": -1}`)
+
+		if response.Code != http.StatusBadRequest {
+			t.Errorf("Expect status to be %v, but got %v", http.StatusBadRequest, response.Code)
+		}
+	})
+
+	t.Run("rejected patch does not change the config", func(t *testing.T) {
+		response := configRequest(http.MethodPatch, "/config/PT%20CRUD%20A", "", `{"metadata": {"evil": "y"}, "limit": -1}`)
+		if response.Code != http.StatusBadRequest {
+			t.Fatalf("Expect status to be %v, but got %v", http.StatusBadRequest, response.Code)
+		}
+
+		clientData, _, _ := rateLimiterStore.Get("PT CRUD A")
+		if _, ok := clientData.Metadata["evil"]; ok || clientData.Limit != 20 {
+			t.Errorf("Expect config to be unchanged, but got %+v", clientData)
+		}
+	})
+
+	t.Run("patch replaces the metadata", func(t *testing.T) {
+		response := configRequest(http.MethodPatch, "/config/PT%20CRUD%20A", "", `{"metadata": {"owner": "platform"}}`)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expect status to be %v, but got %v", http.StatusOK, response.Code)
+		}
+
+		clientData, _, _ := rateLimiterStore.Get("PT CRUD A")
+		if !reflect.DeepEqual(clientData.Metadata, map[string]string{"owner": "platform"}) || clientData.Limit != 20 {
+			t.Errorf("Expect metadata to be %v, but got %+v", map[string]string{"owner": "platform"}, clientData)
+		}
+	})
+
+	t.Run("patch replaces the additional limits", func(t *testing.T) {
+		configRequest(http.MethodPost, "/config", "PT Patch Limits", `{"limit": 10, "window": 60, "limits": [{"algorithm": "token_bucket", "capacity": 5, "refill_per_second": 1}]}`)
+		response := configRequest(http.MethodPatch, "/config/PT%20Patch%20Limits", "", `{"limits": [{"limit": 3, "window": 1}]}`)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expect status to be %v, but got %v", http.StatusOK, response.Code)
+		}
+
+		clientData, _, _ := rateLimiterStore.Get("PT Patch Limits")
+		if len(clientData.Limits) != 1 || clientData.Limits[0].Algorithm != "" || clientData.Limits[0].Capacity != 0 || clientData.Limits[0].Limit != 3 {
+			t.Errorf("Expect additional limits to be replaced, but got %+v", clientData.Limits)
+		}
+	})
+
+	t.Run("patch unknown client", func(t *testing.T) {
+		response := configRequest(http.MethodPatch, "/config/PT%20Unknown", "", `{"limit": 20}`)
+
+		if response.Code != http.StatusNotFound {
+			t.Errorf("Expect status to be %v, but got %v", http.StatusNotFound, response.Code)
+		}
+
+		if _, ok, _ := rateLimiterStore.Get("PT Unknown"); ok {
+			t.Errorf("Expect unknown client to not be created")
+		}
+	})
+
+	t.Run("delete reverts to the default config", func(t *testing.T) {
+		response := configRequest(http.MethodDelete, "/config/PT%20CRUD%20C", "", "")
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expect status to be %v, but got %v", http.StatusOK, response.Code)
+		}
+
+		clientData, _, _ := rateLimiterStore.Get("PT CRUD C")
+		if clientData.Configured || clientData.Limit != config.DefaultLimit {
+			t.Errorf("Expect default config, but got %+v", clientData)
+		}
+
+		response = configRequest(http.MethodDelete, "/config/PT%20Unknown", "", "")
+		if response.Code != http.StatusNotFound {
+			t.Errorf("Expect status to be %v, but got %v", http.StatusNotFound, response.Code)
+		}
+	})
+
+	t.Run("delete client without a config", func(t *testing.T) {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("clientID", "PT CRUD Default")
+		requestHandler(httptest.NewRecorder(), request)
+
+		response := configRequest(http.MethodDelete, "/config/PT%20CRUD%20Default", "", "")
+		if response.Code != http.StatusNotFound {
+			t.Errorf("Expect status to be %v, but got %v", http.StatusNotFound, response.Code)
+		}
+
+		clientData, ok, _ := rateLimiterStore.Get("PT CRUD Default")
+		if !ok || clientData.Requests != 1 {
+			t.Errorf("Expect usage of the client to be kept, but got %+v", clientData)
+		}
+	})
+}
+
+func TestStatusHandler(t *testing.T) {
+	getStatus := func(clientID string) (*httptest.ResponseRecorder, StatusResponse) {
+		request := httptest.NewRequest(http.MethodGet, "/status", nil)
+		if clientID != "" {
+			request.Header.Set("clientID", clientID)
+		}
+		response := httptest.NewRecorder()
+		statusHandler(response, request)
+
+		var statusResponse StatusResponse
+		json.NewDecoder(response.Body).Decode(&statusResponse)
+		return response, statusResponse
+	}
+	clientID := "PT Status"
+	postRequest := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(`{"limit": 3, "window": 60, "limits": [{"name": "burst", "limit": 2, "window": 1}]}`))
+	postRequest.Header.Set("clientID", clientID)
+	requestHandlerConfig(httptest.NewRecorder(), postRequest)
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("clientID", clientID)
+	requestHandler(httptest.NewRecorder(), request)
+
+	t.Run("status of every limit", func(t *testing.T) {
+		response, statusResponse := getStatus(clientID)
+		if response.Code != http.StatusOK {
+			t.Errorf("Expect status to be %v, but got %v", http.StatusOK, response.Code)
+		}
+		if statusResponse.Remaining == nil || *statusResponse.Remaining != 1 {
+			t.Errorf("Expect remaining to be %v, but got %v", 1, statusResponse.Remaining)
+		}
+		if len(statusResponse.Limits) != 2 {
+			t.Fatalf("Expect limits to be %v, but got %v", 2, len(statusResponse.Limits))
+		}
+		if limit := statusResponse.Limits[0]; limit.Limit != 3 || limit.Used != 1 || limit.Remaining != 2 {
+			t.Errorf("Expect limit to be %v / %v used, but got %v / %v", 1, 3, limit.Used, limit.Limit)
+		}
+		if limit := statusResponse.Limits[1]; limit.Name != "burst" || limit.Used != 1 || limit.Remaining != 1 {
+			t.Errorf("Expect burst limit to have %v used, but got %v", 1, limit)
+		}
+	})
+
+	t.Run("status does not use the limit", func(t *testing.T) {
+		for range 5 {
+			getStatus(clientID)
+		}
+		_, statusResponse := getStatus(clientID)
+		if statusResponse.Remaining == nil || *statusResponse.Remaining != 1 {
+			t.Errorf("Expect remaining to be %v, but got %v", 1, statusResponse.Remaining)
+		}
+
+		response := httptest.NewRecorder()
+		requestHandler(response, request)
+		if response.Code != http.StatusOK {
+			t.Errorf("Expect status to be %v, but got %v", http.StatusOK, response.Code)
+		}
+	})
+
+	t.Run("unknown client is not added to the store", func(t *testing.T) {
+		response, statusResponse := getStatus("PT Status Unknown")
+		if response.Code != http.StatusOK || *statusResponse.Remaining != config.DefaultLimit {
+			t.Errorf("Expect remaining to be %v, but got %v", config.DefaultLimit, *statusResponse.Remaining)
+		}
+		if _, ok, _ := rateLimiterStore.Get("PT Status Unknown"); ok {
+			t.Errorf("Expect client to be %v, but got %v", "missing", "stored")
+		}
+	})
+
+	t.Run("no clientID", func(t *testing.T) {
+		if response, _ := getStatus(""); response.Code != http.StatusBadRequest {
+			t.Errorf("Expect status to be %v, but got %v", http.StatusBadRequest, response.Code)
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		response := httptest.NewRecorder()
+		statusHandler(response, httptest.NewRequest(http.MethodPost, "/status", nil))
+		if response.Code != http.StatusMethodNotAllowed {
+			t.Errorf("Expect status to be %v, but got %v", http.StatusMethodNotAllowed, response.Code)
+		}
+	})
+}
+
+func TestRequestHandlerMaxWait(t *testing.T) {
+	t.Run("waiting requests are released in the order they arrived", func(t *testing.T) {
+		clientID := "PT Max Wait"
+		configRequest := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(`{"limit": 1, "window": "200ms", "max_wait": "2s"}`))
+		configRequest.Header.Set("clientID", clientID)
+		requestHandlerConfig(httptest.NewRecorder(), configRequest)
+		makeRequest := func() int {
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("clientID", clientID)
+			response := httptest.NewRecorder()
+			requestHandler(response, request)
+			return response.Code
+		}
+		makeRequest()
+
+		var mutex sync.Mutex
+		order := []int{}
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if code := makeRequest(); code != http.StatusOK {
+					t.Errorf("Expect status of request %v to be %v, but got %v", i, http.StatusOK, code)
+				}
+				mutex.Lock()
+				order = append(order, i)
+				mutex.Unlock()
+			}()
+			// Start the requests one after the other, so they start waiting in order
+			time.Sleep(20 * time.Millisecond)
+		}
+		wg.Wait()
 
-		request := httptest.NewRequest(http.MethodPost, "/config", requestBody)
+		if !reflect.DeepEqual(order, []int{0, 1, 2}) {
+			t.Errorf("Expect requests to be released in order %v, but got %v", []int{0, 1, 2}, order)
+		}
+	})
+}
+
+func TestRequestHandlerRateLimitHeaders(t *testing.T) {
+	clientID := "PT Headers"
+	configRequest := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(`{"limit": 2, "window": 60, "limits": [{"limit": 10, "window": 3600}]}`))
+	configRequest.Header.Set("clientID", clientID)
+	requestHandlerConfig(httptest.NewRecorder(), configRequest)
+	makeRequest := func() *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
 		request.Header.Set("clientID", clientID)
 		response := httptest.NewRecorder()
-		requestHandlerConfig(response, request)
-		var body Body
-		json.Unmarshal(response.Body.Bytes(), &body)
+		requestHandler(response, request)
+		return response
+	}
 
-		if body.Status != expectedStatus {
-			t.Errorf("Expect status to be %v, but got %v", expectedStatus, body.Status)
+	t.Run("headers of an allowed request", func(t *testing.T) {
+		response := makeRequest()
+		expected := map[string]string{
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": "1",
+			"RateLimit-Reset":     "60",
+			"RateLimit-Policy":    "2;w=60, 10;w=3600",
+			"Retry-After":         "",
+			"X-RateLimit-Limit":   "",
 		}
+		for name, value := range expected {
+			if header := response.Header().Get(name); header != value {
+				t.Errorf("Expect %v to be %v, but got %v", name, value, header)
+			}
+		}
+	})
 
-		if body.Message != expectedMessage {
-			t.Errorf("Expect message to be %v, but got %v", expectedMessage, body.Message)
+	t.Run("retry after of a limited request", func(t *testing.T) {
+		makeRequest()
+		response := makeRequest()
+		if response.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expect status to be %v, but got %v", http.StatusTooManyRequests, response.Code)
+		}
+		if header := response.Header().Get("RateLimit-Remaining"); header != "0" {
+			t.Errorf("Expect RateLimit-Remaining to be %v, but got %v", 0, header)
+		}
+		if header := response.Header().Get("Retry-After"); header != "60" {
+			t.Errorf("Expect Retry-After to be %v, but got %v", 60, header)
+		}
+	})
+
+	t.Run("headers of a gcra limit with a burst", func(t *testing.T) {
+		gcraClientID := "PT Headers GCRA"
+		configRequest := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(`{"algorithm": "gcra", "limit": 100, "window": 100, "burst": 5}`))
+		configRequest.Header.Set("clientID", gcraClientID)
+		requestHandlerConfig(httptest.NewRecorder(), configRequest)
+
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("clientID", gcraClientID)
+		response := httptest.NewRecorder()
+		requestHandler(response, request)
+		expected := map[string]string{
+			"RateLimit-Limit":     "5",
+			"RateLimit-Remaining": "4",
+			"RateLimit-Reset":     "1",
+			"RateLimit-Policy":    "5;w=5",
+		}
+		for name, value := range expected {
+			if header := response.Header().Get(name); header != value {
+				t.Errorf("Expect %v to be %v, but got %v", name, value, header)
+			}
+		}
+	})
+
+	t.Run("headers of a request with too many in flight", func(t *testing.T) {
+		inFlightClientID := "PT Headers In Flight"
+		configRequest := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(`{"limit": 2, "window": 60, "max_in_flight": 1}`))
+		configRequest.Header.Set("clientID", inFlightClientID)
+		requestHandlerConfig(httptest.NewRecorder(), configRequest)
+		rateLimiter.AcquireInFlight(inFlightClientID, rateLimiterStore)
+		defer rateLimiter.ReleaseInFlight(inFlightClientID)
+
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("clientID", inFlightClientID)
+		response := httptest.NewRecorder()
+		limitInFlight(requestHandler)(response, request)
+		if response.Code != http.StatusTooManyRequests {
+			t.Fatalf("Expect status to be %v, but got %v", http.StatusTooManyRequests, response.Code)
+		}
+
+		expected := map[string]string{
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": "2",
+			"RateLimit-Policy":    "2;w=60",
+			"Retry-After":         "1",
+		}
+		for name, value := range expected {
+			if header := response.Header().Get(name); header != value {
+				t.Errorf("Expect %v to be %v, but got %v", name, value, header)
+			}
+		}
+	})
+
+	t.Run("legacy headers", func(t *testing.T) {
+		config.LegacyRateLimitHeaders = true
+		defer func() { config.LegacyRateLimitHeaders = false }()
+
+		response := makeRequest()
+		if header := response.Header().Get("X-RateLimit-Limit"); header != "2" {
+			t.Errorf("Expect X-RateLimit-Limit to be %v, but got %v", 2, header)
+		}
+		if header := response.Header().Get("X-RateLimit-Remaining"); header != "0" {
+			t.Errorf("Expect X-RateLimit-Remaining to be %v, but got %v", 0, header)
+		}
+		reset, err := strconv.ParseInt(response.Header().Get("X-RateLimit-Reset"), 10, 64)
+		if err != nil || reset < time.Now().Unix() {
+			t.Errorf("Expect X-RateLimit-Reset to be a future time in seconds since epoch, but got %v", response.Header().Get("X-RateLimit-Reset"))
 		}
 	})
 }
 
-func TestRequestHandlerConfigSuccess(t *testing.T) {
-	t.Run("successful request", func(t *testing.T) {
-		clientID := "PT A"
-		expectedStatus := http.StatusOK
-		expectedMessage := fmt.Sprintf("New config created for %v", clientID)
-		requestBody := strings.NewReader(`{
-			"limit": 10,
-			"window": 1
-		}`)
+func TestRequestHandlerConfigDurations(t *testing.T) {
+	getConfig := func(clientID string) ClientConfig {
+		request := httptest.NewRequest(http.MethodGet, "/config", nil)
+		request.Header.Set("clientID", clientID)
+		response := httptest.NewRecorder()
+		requestHandlerConfig(response, request)
+
+		var body ConfigResponse
+		json.NewDecoder(response.Body).Decode(&body)
+		if body.Config == nil {
+			t.Fatalf("Expect config of %v, but got %v", clientID, response.Body)
+		}
+		return *body.Config
+	}
 
-		request := httptest.NewRequest(http.MethodPost, "/config", requestBody)
+	t.Run("duration strings and rate shorthand", func(t *testing.T) {
+		clientID := "PT Durations"
+		request := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(`{
+			"window": "500ms",
+			"limit": 5,
+			"max_wait": "2s",
+			"limits": [{"rate": "100/min"}]
+		}`))
 		request.Header.Set("clientID", clientID)
 		response := httptest.NewRecorder()
 		requestHandlerConfig(response, request)
-		var body Body
-		json.Unmarshal(response.Body.Bytes(), &body)
+		if response.Code != http.StatusOK {
+			t.Fatalf("Expect status to be %v, but got %v", http.StatusOK, response.Code)
+		}
 
-		if body.Status != expectedStatus {
-			t.Errorf("Expect status to be %v, but got %v", expectedStatus, body.Status)
+		clientConfig := getConfig(clientID)
+		if clientConfig.Window != 0.5 || clientConfig.MaxWait != 2 {
+			t.Errorf("Expect window and max wait to be %v and %v, but got %v and %v", 0.5, 2, clientConfig.Window, clientConfig.MaxWait)
 		}
+		if limit := clientConfig.Limits[0]; limit.Limit != 100 || limit.Window != 60 || limit.Rate != nil {
+			t.Errorf("Expect additional limit to be %v per %v, but got %v per %v", 100, 60, limit.Limit, limit.Window)
+		}
+	})
 
-		if body.Message != expectedMessage {
-			t.Errorf("Expect message to be %v, but got %v", expectedMessage, body.Message)
+	t.Run("integer window is still seconds", func(t *testing.T) {
+		clientID := "PT Integer Window"
+		request := httptest.NewRequest(http.MethodPost, "/config", strings.NewReader(`{"limit": 5, "window": 60}`))
+		request.Header.Set("clientID", clientID)
+		requestHandlerConfig(httptest.NewRecorder(), request)
+
+		clientData, _, _ := rateLimiterStore.Get(clientID)
+		if clientData.Window != time.Minute {
+			t.Errorf("Expect window to be %v, but got %v", time.Minute, clientData.Window)
+		}
+	})
+
+	t.Run("rate replaces the limit and window when patched", func(t *testing.T) {
+		clientID := "PT Integer Window"
+		request := httptest.NewRequest(http.MethodPatch, "/config", strings.NewReader(`{"rate": "10/hour"}`))
+		request.Header.Set("clientID", clientID)
+		requestHandlerConfig(httptest.NewRecorder(), request)
+
+		clientData, _, _ := rateLimiterStore.Get(clientID)
+		if clientData.Limit != 10 || clientData.Window != time.Hour {
+			t.Errorf("Expect limit to be %v per %v, but got %v per %v", 10, time.Hour, clientData.Limit, clientData.Window)
+		}
+	})
+}
+
+// conflictStore is a store where every update conflicts with another instance
+type conflictStore struct {
+	validator.Store
+}
+
+func (conflictStore) Update(string, func(validator.RateLimiterData, bool) validator.RateLimiterData) error {
+	return redisstore.ErrConflict
+}
+
+func TestRequestHandlerConflict(t *testing.T) {
+	t.Run("conflicting updates are retried by the client", func(t *testing.T) {
+		defer func(store validator.Store) { rateLimiterStore = store }(rateLimiterStore)
+		rateLimiterStore = conflictStore{Store: validator.NewMemoryStore(nil)}
+		expectedStatus := http.StatusServiceUnavailable
+
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("clientID", "PT Conflict")
+		response := httptest.NewRecorder()
+		requestHandler(response, request)
+
+		if response.Code != expectedStatus {
+			t.Errorf("Expect status to be %v, but got %v", expectedStatus, response.Code)
+		}
+		if header := response.Header().Get("Retry-After"); header != "1" {
+			t.Errorf("Expect Retry-After to be %v, but got %v", 1, header)
 		}
 	})
 }
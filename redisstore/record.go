@@ -0,0 +1,105 @@
+package redisstore
+
+import (
+	"rate_limiter/validator"
+	"time"
+)
+
+// record is the data of a client as it is kept in Redis
+// Durations and times are kept in milliseconds so they can be used as numbers by the Lua scripts
+// A zero time is kept as 0
+type record struct {
+	Requests               int               `json:"requests"`
+	Limit                  int               `json:"limit"`
+	Window                 int64             `json:"window"`
+	FirstRequestTime       int64             `json:"first_request_time"`
+	Algorithm              string            `json:"algorithm,omitempty"`
+	Capacity               int               `json:"capacity,omitempty"`
+	RefillPerSecond        float64           `json:"refill_per_second,omitempty"`
+	Tokens                 float64           `json:"tokens,omitempty"`
+	LastRefillTime         int64             `json:"last_refill_time,omitempty"`
+	Log                    []int64           `json:"log,omitempty"`
+	PreviousRequests       int               `json:"previous_requests,omitempty"`
+	Burst                  int               `json:"burst,omitempty"`
+	TheoreticalArrivalTime int64             `json:"theoretical_arrival_time,omitempty"`
+	MaxWait                int64             `json:"max_wait,omitempty"`
+	MaxInFlight            int               `json:"max_in_flight,omitempty"`
+	Name                   string            `json:"name,omitempty"`
+	Limits                 []record          `json:"limits,omitempty"`
+	Configured             bool              `json:"configured,omitempty"`
+	UpdatedAt              int64             `json:"updated_at,omitempty"`
+	Metadata               map[string]string `json:"metadata,omitempty"`
+}
+
+func toRecord(data validator.RateLimiterData) record {
+	r := record{
+		Requests:               data.Requests,
+		Limit:                  data.Limit,
+		Window:                 data.Window.Milliseconds(),
+		FirstRequestTime:       toMillis(data.FirstRequestTime),
+		Algorithm:              data.Algorithm,
+		Capacity:               data.Capacity,
+		RefillPerSecond:        data.RefillPerSecond,
+		Tokens:                 data.Tokens,
+		LastRefillTime:         toMillis(data.LastRefillTime),
+		PreviousRequests:       data.PreviousRequests,
+		Burst:                  data.Burst,
+		TheoreticalArrivalTime: toMillis(data.TheoreticalArrivalTime),
+		MaxWait:                data.MaxWait.Milliseconds(),
+		MaxInFlight:            data.MaxInFlight,
+		Name:                   data.Name,
+		Configured:             data.Configured,
+		UpdatedAt:              toMillis(data.UpdatedAt),
+		Metadata:               data.Metadata,
+	}
+	for _, requestTime := range data.Log {
+		r.Log = append(r.Log, toMillis(requestTime))
+	}
+	for _, limit := range data.Limits {
+		r.Limits = append(r.Limits, toRecord(limit))
+	}
+	return r
+}
+
+func (r record) toData() validator.RateLimiterData {
+	var data validator.RateLimiterData
+	data.Requests = r.Requests
+	data.Limit = r.Limit
+	data.Window = time.Duration(r.Window) * time.Millisecond
+	data.FirstRequestTime = fromMillis(r.FirstRequestTime)
+	data.Algorithm = r.Algorithm
+	data.Capacity = r.Capacity
+	data.RefillPerSecond = r.RefillPerSecond
+	data.Tokens = r.Tokens
+	data.LastRefillTime = fromMillis(r.LastRefillTime)
+	data.PreviousRequests = r.PreviousRequests
+	data.Burst = r.Burst
+	data.TheoreticalArrivalTime = fromMillis(r.TheoreticalArrivalTime)
+	data.MaxWait = time.Duration(r.MaxWait) * time.Millisecond
+	data.MaxInFlight = r.MaxInFlight
+	data.Name = r.Name
+	data.Configured = r.Configured
+	data.UpdatedAt = fromMillis(r.UpdatedAt)
+	data.Metadata = r.Metadata
+	for _, requestTime := range r.Log {
+		data.Log = append(data.Log, fromMillis(requestTime))
+	}
+	for _, limit := range r.Limits {
+		data.Limits = append(data.Limits, limit.toData())
+	}
+	return data
+}
+
+func toMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromMillis(millis int64) time.Time {
+	if millis == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(millis)
+}
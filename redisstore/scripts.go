@@ -0,0 +1,228 @@
+package redisstore
+
+import (
+	"github.com/redis/go-redis/v9"
+)
+
+// compareAndSetScript only writes the new record if the key still contains the record that was read
+// KEYS[1]: key of the client
+// ARGV[1]: record that was read, empty if the key did not exist
+// ARGV[2]: new record
+// ARGV[3]: expiry in milliseconds, 0 to keep the key until it is deleted
+var compareAndSetScript = redis.NewScript(`
+local current = redis.call('GET', KEYS[1])
+if (current or '') ~= ARGV[1] then
+	return 0
+end
+
+if tonumber(ARGV[3]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+else
+	redis.call('SET', KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// checkScript decides whether a request is allowed by every limit of a client in a single script, with the same behaviour as the validator
+// Every built-in algorithm is handled, including additional limits. The request is only counted when every limit allows it
+// Clients created from the default values expire once they are the same as a new client
+// KEYS[1]: key of the client
+// ARGV[1]: current time in milliseconds
+// ARGV[2]: cost of the request
+// ARGV[3], ARGV[4], ARGV[5]: default requests, limit and window in milliseconds for a new client
+// ARGV[6]: default algorithm
+// ARGV[7]: default max in flight for a new client
+// ARGV[8]: maximum size of a sliding log
+// Returns {status, record}, where status is 1 if allowed, 0 if limited, and -1 if a limit uses an algorithm that is not handled,
+// such as a registered algorithm
+var checkScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local cost = tonumber(ARGV[2])
+local max_log_size = tonumber(ARGV[8])
+
+local raw = redis.call('GET', KEYS[1])
+local data
+local new = false
+if raw then
+	data = cjson.decode(raw)
+else
+	data = {requests = tonumber(ARGV[3]), limit = tonumber(ARGV[4]), window = tonumber(ARGV[5]), first_request_time = now}
+	if tonumber(ARGV[7]) > 0 then
+		data.max_in_flight = tonumber(ARGV[7])
+	end
+	-- A new client that is limited is kept as it was created, the same as the validator
+	raw = cjson.encode(data)
+	data = cjson.decode(raw)
+	new = true
+end
+
+-- Each algorithm checks a single limit and changes it in place
+-- It returns whether the request is allowed, and the time after which the limit is the same as a new one
+local algorithms = {}
+
+-- Shared by the counter and fixed window algorithms, which both keep the start of the window in first_request_time
+local function count(limit, window_end)
+	if limit.requests + cost > limit.limit then
+		return false, window_end
+	end
+	limit.requests = limit.requests + cost
+	return true, window_end
+end
+
+function algorithms.counter(limit)
+	-- If first request has already exceeded the time window, refresh the request to 0
+	if now - limit.first_request_time > limit.window then
+		limit.requests = 0
+		limit.first_request_time = now
+	end
+	return count(limit, limit.first_request_time + limit.window + 1)
+end
+
+function algorithms.fixed_window(limit)
+	-- Windows are aligned to multiples of the window since the zero time of Go, the same as time.Truncate
+	local window_start = now - ((now + 62135596800000) % limit.window)
+	if limit.first_request_time ~= window_start then
+		limit.requests = 0
+		limit.first_request_time = window_start
+	end
+	return count(limit, window_start + limit.window)
+end
+
+function algorithms.gcra(limit)
+	-- Requests are spaced by window / limit, and up to burst requests can arrive earlier than their theoretical arrival time
+	local interval = limit.window / limit.limit
+	local burst = limit.burst or 0
+	if burst <= 0 then
+		burst = limit.limit
+	end
+	local tat = math.max(limit.theoretical_arrival_time or 0, now)
+	local new_tat = tat + interval * cost
+	if now < new_tat - interval * burst then
+		return false, tat + 1
+	end
+
+	-- Times are kept as whole milliseconds, rounded up so the spacing between requests is never shorter
+	limit.theoretical_arrival_time = math.ceil(new_tat)
+	return true, limit.theoretical_arrival_time + 1
+end
+
+function algorithms.token_bucket(limit)
+	-- A new bucket starts full so the client is able to burst right away
+	if (limit.last_refill_time or 0) == 0 then
+		limit.tokens = limit.capacity
+		limit.last_refill_time = now
+	end
+	local elapsed = now - limit.last_refill_time
+	if elapsed > 0 then
+		limit.tokens = math.min(limit.capacity, (limit.tokens or 0) + elapsed / 1000 * limit.refill_per_second)
+		limit.last_refill_time = now
+	end
+
+	local allowed = limit.tokens >= cost
+	if allowed then
+		limit.tokens = limit.tokens - cost
+	end
+	-- The bucket is the same as a new bucket once it is full again
+	return allowed, now + math.ceil((limit.capacity - limit.tokens) / limit.refill_per_second * 1000)
+end
+
+function algorithms.sliding_log(limit)
+	-- Only keep requests that are still within the window
+	local log = {}
+	for _, request_time in ipairs(limit.log or {}) do
+		if request_time > now - limit.window then
+			table.insert(log, request_time)
+		end
+	end
+
+	-- The log is capped even if the limit is higher, so a single client can not use unbounded memory
+	local allowed = #log + cost <= math.min(limit.limit, max_log_size)
+	if allowed then
+		for i = 1, cost do
+			table.insert(log, now)
+		end
+	end
+	-- An empty table is encoded as an object, so an empty log is removed instead
+	if #log == 0 then
+		limit.log = nil
+		return allowed, now
+	end
+	limit.log = log
+	return allowed, log[#log] + limit.window
+end
+
+function algorithms.sliding_window(limit)
+	local window = limit.window
+	if (limit.first_request_time or 0) == 0 then
+		limit.first_request_time = now
+	end
+	limit.requests = limit.requests or 0
+	limit.previous_requests = limit.previous_requests or 0
+
+	-- Move to the window containing the current time
+	-- The previous count is only kept if the previous window is directly before the current one
+	local elapsed = now - limit.first_request_time
+	if elapsed >= window then
+		local windows = math.floor(elapsed / window)
+		if windows == 1 then
+			limit.previous_requests = limit.requests
+		else
+			limit.previous_requests = 0
+		end
+		limit.requests = 0
+		limit.first_request_time = limit.first_request_time + windows * window
+		elapsed = elapsed - windows * window
+	end
+
+	local allowed = limit.previous_requests * (1 - elapsed / window) + limit.requests + cost <= limit.limit
+	if allowed then
+		limit.requests = limit.requests + cost
+	end
+	-- Both counts have left the rolling window after 2 windows
+	return allowed, limit.first_request_time + 2 * window
+end
+
+local limits = {data}
+for _, limit in ipairs(data.limits or {}) do
+	table.insert(limits, limit)
+end
+
+local checks = {}
+for i, limit in ipairs(limits) do
+	local algorithm = limit.algorithm
+	if algorithm == nil or algorithm == '' then
+		algorithm = ARGV[6]
+	end
+	if algorithms[algorithm] == nil then
+		return {-1, ''}
+	end
+	checks[i] = algorithms[algorithm]
+end
+
+-- Every limit is checked, so the expiry covers every limit
+local allowed = true
+local expires_at = now
+for i, limit in ipairs(limits) do
+	local limit_allowed, limit_expires_at = checks[i](limit)
+	allowed = allowed and limit_allowed
+	expires_at = math.max(expires_at, limit_expires_at)
+end
+
+-- A limited request does not change the stored record, unless the client is new
+local record = raw
+if allowed then
+	record = cjson.encode(data)
+elseif not new then
+	return {0, raw}
+end
+
+if data.configured then
+	redis.call('SET', KEYS[1], record)
+else
+	redis.call('SET', KEYS[1], record, 'PX', math.max(expires_at - now, 1))
+end
+if allowed then
+	return {1, record}
+end
+return {0, record}
+`)
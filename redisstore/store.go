@@ -0,0 +1,174 @@
+package redisstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"rate_limiter/config"
+	"rate_limiter/validator"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Maximum number of attempts of Update when the data keeps being changed by another instance
+const maxUpdateAttempts = 100
+
+var ErrConflict = errors.New("redisstore: too many conflicting updates")
+
+// Store keeps the data of every client in Redis, so it can be shared between multiple instances of the rate limiter
+// Each client is kept as a JSON record in its own key, and clients created from the default values expire once their window has passed
+type Store struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewStore(client redis.UniversalClient) *Store {
+	return &Store{client: client, prefix: config.RedisKeyPrefix}
+}
+
+func (s *Store) key(clientID string) string {
+	return s.prefix + clientID
+}
+
+func (s *Store) Get(clientID string) (validator.RateLimiterData, bool, error) {
+	raw, err := s.client.Get(context.Background(), s.key(clientID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return validator.RateLimiterData{}, false, nil
+	}
+	if err != nil {
+		return validator.RateLimiterData{}, false, err
+	}
+
+	data, err := decode(raw)
+	return data, err == nil, err
+}
+
+// Update reads the data of the client, and only writes the new data if the key has not been changed in the meantime
+// The check and write is done in a single script, and the update is retried when the key was changed by another instance
+func (s *Store) Update(clientID string, update func(data validator.RateLimiterData, ok bool) validator.RateLimiterData) error {
+	ctx := context.Background()
+	key := s.key(clientID)
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		raw, err := s.client.Get(ctx, key).Result()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			return err
+		}
+
+		var data validator.RateLimiterData
+		ok := err == nil
+		if ok {
+			if data, err = decode(raw); err != nil {
+				return err
+			}
+		}
+
+		newData := update(data, ok)
+		encoded, err := json.Marshal(toRecord(newData))
+		if err != nil {
+			return err
+		}
+
+		updated, err := compareAndSetScript.Run(ctx, s.client, []string{key}, raw, encoded, expiry(newData).Milliseconds()).Int()
+		if err != nil {
+			return err
+		}
+		if updated == 1 {
+			return nil
+		}
+		log.Printf("Conflicting update for %v, retrying\n", clientID)
+	}
+	return ErrConflict
+}
+
+func (s *Store) Delete(clientID string) error {
+	return s.client.Del(context.Background(), s.key(clientID)).Err()
+}
+
+func (s *Store) List() (map[string]validator.RateLimiterData, error) {
+	ctx := context.Background()
+	data := map[string]validator.RateLimiterData{}
+	iter := s.client.Scan(ctx, 0, s.prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		raw, err := s.client.Get(ctx, iter.Val()).Result()
+		// The key may have expired since it was scanned
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		clientData, err := decode(raw)
+		if err != nil {
+			return nil, err
+		}
+		data[iter.Val()[len(s.prefix):]] = clientData
+	}
+	return data, iter.Err()
+}
+
+// CheckRequestLimit checks every limit of the client in a single script, without any read-modify-write from this instance
+// Clients using an algorithm that is not built in, such as a registered algorithm, are not handled and are updated through Update instead
+func (s *Store) CheckRequestLimit(clientID string, currentTime time.Time, cost int) (validator.RateLimitCheckResult, bool, error) {
+	result, err := checkScript.Run(context.Background(), s.client, []string{s.key(clientID)},
+		currentTime.UnixMilli(), cost,
+		config.DefaultRequest, config.DefaultLimit, config.DefaultWindow.Milliseconds(), config.DefaultAlgorithm,
+		config.DefaultMaxInFlight, config.MaxSlidingLogSize,
+	).Slice()
+	if err != nil {
+		return validator.RateLimitCheckResult{}, false, err
+	}
+
+	// The script returns -1 when a limit of the client uses an algorithm it does not handle
+	status := result[0].(int64)
+	if status == -1 {
+		return validator.RateLimitCheckResult{}, false, nil
+	}
+
+	data, err := decode(result[1].(string))
+	if err != nil {
+		return validator.RateLimitCheckResult{}, false, err
+	}
+
+	// The result is described by checking the stored data the same way as the validator
+	// A limited request did not change the data, so it is checked again with its cost to find the limit reached and the retry after
+	// An allowed request is already counted in the data, so it is checked without any cost
+	checkCost := cost
+	if status == 1 {
+		checkCost = 0
+	}
+	checkResult := validator.CheckLimits(data, currentTime, checkCost)
+	checkResult.Status = status == 1
+	checkResult.Data = data
+	return checkResult, true, nil
+}
+
+func decode(raw string) (validator.RateLimiterData, error) {
+	var r record
+	if err := json.Unmarshal([]byte(raw), &r); err != nil {
+		return validator.RateLimiterData{}, err
+	}
+	return r.toData(), nil
+}
+
+// expiry returns how long the data of the client is kept after the last update
+// Configured clients are kept until they are deleted, while clients created from the default values only need to be kept
+// until every limit has been refreshed, after which they are the same as a new client
+func expiry(data validator.RateLimiterData) time.Duration {
+	if data.Configured {
+		return 0
+	}
+
+	longest := time.Duration(0)
+	for _, limit := range append([]validator.RateLimiterData{data}, data.Limits...) {
+		window := limit.Window
+		if limit.Algorithm == validator.AlgorithmTokenBucket && limit.RefillPerSecond > 0 {
+			window = time.Duration(float64(limit.Capacity) / limit.RefillPerSecond * float64(time.Second))
+		}
+		longest = max(longest, window)
+	}
+	// The sliding window algorithm still uses the previous window, so the data is kept for 2 windows
+	return 2 * longest
+}
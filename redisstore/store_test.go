@@ -0,0 +1,234 @@
+package redisstore
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"rate_limiter/config"
+	"rate_limiter/validator"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestClient connects to the Redis server in REDIS_ADDR if it is set, otherwise an in-process fake server is started
+func newTestClient(t *testing.T) *redis.Client {
+	log.SetOutput(io.Discard)
+	if address := os.Getenv("REDIS_ADDR"); address != "" {
+		client := redis.NewClient(&redis.Options{Addr: address})
+		if err := client.FlushDB(context.Background()).Err(); err != nil {
+			t.Fatalf("Expect Redis to be available at %v, but got %v", address, err)
+		}
+		return client
+	}
+	return redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+}
+
+func TestCheckRequestLimit(t *testing.T) {
+	t.Run("new client uses default values and expires after the window", func(t *testing.T) {
+		client := newTestClient(t)
+		store := NewStore(client)
+		rateLimiter := validator.RateLimiter{}
+		currentTime := time.Now()
+
+		for i := 0; i < config.DefaultLimit; i++ {
+			response, err := rateLimiter.ValidateRequestLimit("PT New", currentTime, store)
+			if err != nil || !response.Status {
+				t.Fatalf("Expect request %v to be allowed, but got %v and %v", i+1, response.Status, err)
+			}
+		}
+
+		response, err := rateLimiter.ValidateRequestLimit("PT New", currentTime, store)
+		if err != nil || response.Status {
+			t.Errorf("Expect request to be limited, but got %v and %v", response.Status, err)
+		}
+
+		if response.RetryAfter <= 0 || response.RetryAfter > config.DefaultWindow+time.Millisecond {
+			t.Errorf("Expect retry after to be within the window, but got %v", response.RetryAfter)
+		}
+
+		ttl := client.PTTL(context.Background(), config.RedisKeyPrefix+"PT New").Val()
+		if ttl <= 0 || ttl > config.DefaultWindow+time.Millisecond {
+			t.Errorf("Expect key to expire within the window, but got %v", ttl)
+		}
+	})
+
+	t.Run("configured client does not expire", func(t *testing.T) {
+		client := newTestClient(t)
+		store := NewStore(client)
+		currentTime := time.Now()
+		store.Update("PT A", func(validator.RateLimiterData, bool) validator.RateLimiterData {
+			return validator.NewRateLimiterData(validator.CreateData{Limit: 1, Window: 1}, currentTime)
+		})
+
+		response, _, err := store.CheckRequestLimit("PT A", currentTime, 1)
+		if err != nil || !response.Status || response.Data.Requests != 1 {
+			t.Errorf("Expect request to be allowed, but got %v and %v", response, err)
+		}
+
+		ttl := client.PTTL(context.Background(), config.RedisKeyPrefix+"PT A").Val()
+		if ttl >= 0 {
+			t.Errorf("Expect key to not expire, but got %v", ttl)
+		}
+	})
+
+	t.Run("every algorithm and additional limits give the same result as the validator", func(t *testing.T) {
+		store := NewStore(newTestClient(t))
+		// Times are kept in milliseconds by the store, so the test uses whole milliseconds
+		startTime := time.UnixMilli(time.Now().UnixMilli())
+		configs := map[string]validator.CreateData{
+			"PT Counter": {Limit: 3, Window: 1},
+			"PT Fixed":   {Algorithm: validator.AlgorithmFixedWindow, Limit: 3, Window: 7},
+			"PT GCRA":    {Algorithm: validator.AlgorithmGCRA, Limit: 4, Window: 2, Burst: 2},
+			"PT Bucket":  {Algorithm: validator.AlgorithmTokenBucket, Capacity: 3, RefillPerSecond: 2},
+			"PT Log":     {Algorithm: validator.AlgorithmSlidingLog, Limit: 3, Window: 1},
+			"PT Sliding": {Algorithm: validator.AlgorithmSlidingWindow, Limit: 4, Window: 1},
+			"PT Limits": {Limit: 5, Window: 1, Limits: []validator.CreateData{
+				{Name: "hourly", Algorithm: validator.AlgorithmSlidingLog, Limit: 6, Window: 3600},
+				{Algorithm: validator.AlgorithmGCRA, Limit: 2, Window: 1},
+			}},
+		}
+		for clientID, createData := range configs {
+			data := validator.NewRateLimiterData(createData, startTime)
+			store.Update(clientID, func(validator.RateLimiterData, bool) validator.RateLimiterData {
+				return data
+			})
+			memoryStore := validator.NewMemoryStore(map[string]validator.RateLimiterData{clientID: data})
+			rateLimiter := validator.RateLimiter{}
+
+			for i, offset := range []time.Duration{0, 100, 200, 300, 900, 1000, 1100, 1500, 2500, 7000, 7100, 7200} {
+				currentTime := startTime.Add(offset * time.Millisecond)
+				cost := 1 + i%2
+				response, handled, err := store.CheckRequestLimit(clientID, currentTime, cost)
+				if err != nil || !handled {
+					t.Fatalf("Expect %v to be handled by the script, but got %v and %v", clientID, handled, err)
+				}
+				expected, _ := rateLimiter.ValidateRequestLimitN(clientID, currentTime, cost, memoryStore)
+
+				if response.Status != expected.Status || response.Remaining != expected.Remaining || response.Limit != expected.Limit || response.LimitName != expected.LimitName {
+					t.Errorf("Expect %v at %v to be %v with %v of %v remaining (%v), but got %v with %v of %v remaining (%v)", clientID, currentTime.Sub(startTime),
+						expected.Status, expected.Remaining, expected.Limit, expected.LimitName, response.Status, response.Remaining, response.Limit, response.LimitName)
+				}
+				if difference := response.RetryAfter - expected.RetryAfter; difference < 0 || difference > time.Millisecond {
+					t.Errorf("Expect %v retry after at %v to be %v, but got %v", clientID, currentTime.Sub(startTime), expected.RetryAfter, response.RetryAfter)
+				}
+				if difference := response.Reset.Sub(expected.Reset); difference < 0 || difference > time.Millisecond {
+					t.Errorf("Expect %v reset at %v to be %v, but got %v", clientID, currentTime.Sub(startTime), expected.Reset, response.Reset)
+				}
+			}
+		}
+	})
+
+	t.Run("registered algorithms are not handled by the script", func(t *testing.T) {
+		validator.RegisterAlgorithm("PT Registered", validator.CounterAlgorithm{})
+		store := NewStore(newTestClient(t))
+		rateLimiter := validator.RateLimiter{}
+		currentTime := time.Now()
+		store.Update("PT Registered", func(validator.RateLimiterData, bool) validator.RateLimiterData {
+			data := validator.NewRateLimiterData(validator.CreateData{Limit: 2, Window: 60}, currentTime)
+			data.Algorithm = "PT Registered"
+			return data
+		})
+
+		if _, handled, _ := store.CheckRequestLimit("PT Registered", currentTime, 1); handled {
+			t.Errorf("Expect registered algorithm to not be handled by the script")
+		}
+
+		for _, expected := range []bool{true, true, false} {
+			response, err := rateLimiter.ValidateRequestLimit("PT Registered", currentTime, store)
+			if err != nil || response.Status != expected {
+				t.Errorf("Expect validation to be %v, but got %v and %v", expected, response.Status, err)
+			}
+		}
+	})
+
+	t.Run("no over admission across instances", func(t *testing.T) {
+		client := newTestClient(t)
+		limit := 50
+		NewStore(client).Update("PT Shared", func(validator.RateLimiterData, bool) validator.RateLimiterData {
+			return validator.NewRateLimiterData(validator.CreateData{Limit: limit, Window: 60}, time.Now())
+		})
+
+		// Each goroutine acts as a separate instance with its own store and rate limiter
+		var allowed atomic.Int64
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				store := NewStore(client)
+				rateLimiter := validator.RateLimiter{}
+				for j := 0; j < 10; j++ {
+					response, err := rateLimiter.ValidateRequestLimit("PT Shared", time.Now(), store)
+					if err == nil && response.Status {
+						allowed.Add(1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		if allowed.Load() != int64(limit) {
+			t.Errorf("Expect %v requests to be allowed, but got %v", limit, allowed.Load())
+		}
+	})
+}
+
+func TestStore(t *testing.T) {
+	t.Run("get, list and delete", func(t *testing.T) {
+		store := NewStore(newTestClient(t))
+		currentTime := time.UnixMilli(time.Now().UnixMilli())
+		expectedData := validator.NewRateLimiterData(validator.CreateData{
+			Name: "per second", Limit: 10, Window: 1,
+			Limits: []validator.CreateData{{Algorithm: validator.AlgorithmSlidingLog, Limit: 100, Window: 60}},
+		}, currentTime)
+		expectedData.Limits[0].Log = []time.Time{currentTime}
+		store.Update("PT A", func(validator.RateLimiterData, bool) validator.RateLimiterData {
+			return expectedData
+		})
+
+		data, ok, err := store.Get("PT A")
+		if err != nil || !ok {
+			t.Fatalf("Expect client to exist, but got %v and %v", ok, err)
+		}
+
+		if data.Name != expectedData.Name || !data.FirstRequestTime.Equal(currentTime) || !data.Limits[0].Log[0].Equal(currentTime) {
+			t.Errorf("Expect data to be %v, but got %v", expectedData, data)
+		}
+
+		list, err := store.List()
+		if err != nil || len(list) != 1 {
+			t.Errorf("Expect list to contain 1 client, but got %v and %v", list, err)
+		}
+
+		store.Delete("PT A")
+		if _, ok, _ := store.Get("PT A"); ok {
+			t.Errorf("Expect client to be deleted")
+		}
+	})
+
+	t.Run("update retries on conflict", func(t *testing.T) {
+		client := newTestClient(t)
+		store := NewStore(client)
+		attempts := 0
+		err := store.Update("PT A", func(data validator.RateLimiterData, ok bool) validator.RateLimiterData {
+			attempts++
+			// Simulate another instance changing the data between the read and the write
+			if attempts == 1 {
+				client.Set(context.Background(), config.RedisKeyPrefix+"PT A", `{"requests": 5, "limit": 10}`, 0)
+			}
+			data.Requests++
+			return data
+		})
+
+		data, _, _ := store.Get("PT A")
+		if err != nil || attempts != 2 || data.Requests != 6 {
+			t.Errorf("Expect update to be retried on top of the other change, but got %v attempts, %v requests and %v", attempts, data.Requests, err)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"rate_limiter/validator"
+	"time"
+)
+
+// snapshot is the content of the snapshot file
+type snapshot struct {
+	Time    time.Time                            `json:"time"`
+	Clients map[string]validator.RateLimiterData `json:"clients"`
+}
+
+// Save writes the data of every client in the store to the file
+// The snapshot is written to a temporary file first and then renamed, so a crash while saving does not leave a partial snapshot
+func Save(store validator.Store, path string, currentTime time.Time) error {
+	clients, err := store.List()
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if err := json.NewEncoder(file).Encode(snapshot{Time: currentTime, Clients: clients}); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+// Restore loads the clients of the snapshot file into the store, and returns the number of clients restored
+// Clients created from the default values are discarded once all of their limits have been refreshed while the process was down,
+// as they are the same as a new client. Configured clients are always restored so their config is not lost
+// A missing snapshot file is not an error, as there is nothing to restore on the first start
+func Restore(store validator.Store, path string, currentTime time.Time) (int, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var s snapshot
+	if err := json.NewDecoder(file).Decode(&s); err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for clientID, data := range s.Clients {
+		if !data.Configured && validator.IsExpired(data, currentTime) {
+			continue
+		}
+
+		err := store.Update(clientID, func(validator.RateLimiterData, bool) validator.RateLimiterData {
+			return data
+		})
+		if err != nil {
+			return restored, err
+		}
+		restored++
+	}
+	log.Printf("Restored %v clients from snapshot taken at %v\n", restored, s.Time)
+	return restored, nil
+}
+
+// Run saves a snapshot every interval until the context is done
+func Run(ctx context.Context, store validator.Store, path string, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := Save(store, path, time.Now()); err != nil {
+				log.Println("Error saving snapshot:", err)
+			}
+		}
+	}
+}
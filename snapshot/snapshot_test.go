@@ -0,0 +1,86 @@
+package snapshot
+
+import (
+	"os"
+	"path/filepath"
+	"rate_limiter/validator"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSaveAndRestore(t *testing.T) {
+	currentTime := time.Now()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	configured := validator.NewRateLimiterData(validator.CreateData{Limit: 10, Window: 60}, currentTime)
+	configured.Requests = 4
+	clients := map[string]validator.RateLimiterData{
+		"PT Configured": configured,
+		"PT Active":     {Policy: validator.Policy{Limit: 3, Window: 5 * time.Second}, Usage: validator.Usage{Requests: 2, FirstRequestTime: currentTime}},
+		"PT Expired":    {Policy: validator.Policy{Limit: 3, Window: 5 * time.Second}, Usage: validator.Usage{Requests: 3, FirstRequestTime: currentTime.Add(-time.Minute)}},
+	}
+
+	if err := Save(validator.NewMemoryStore(clients), path, currentTime); err != nil {
+		t.Fatalf("Expect no error, but got %v", err)
+	}
+
+	t.Run("restores clients that are still limited", func(t *testing.T) {
+		store := validator.NewMemoryStore(nil)
+		restored, err := Restore(store, path, currentTime.Add(time.Second))
+		if err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
+
+		if restored != 2 {
+			t.Errorf("Expect restored clients to be %v, but got %v", 2, restored)
+		}
+
+		data, ok, _ := store.Get("PT Active")
+		if !ok || data.Requests != 2 || !data.FirstRequestTime.Equal(currentTime) {
+			t.Errorf("Expect active client to be restored, but got %v", data)
+		}
+
+		if _, ok, _ := store.Get("PT Expired"); ok {
+			t.Errorf("Expect expired client to be discarded")
+		}
+	})
+
+	t.Run("keeps configured clients after their window", func(t *testing.T) {
+		store := validator.NewMemoryStore(nil)
+		if _, err := Restore(store, path, currentTime.Add(time.Hour)); err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
+
+		data, ok, _ := store.Get("PT Configured")
+		if !ok || data.Limit != configured.Limit || data.Requests != configured.Requests || !data.Configured {
+			t.Errorf("Expect configured client to be restored %v, but got %v", configured, data)
+		}
+
+		list, _ := store.List()
+		if !reflect.DeepEqual(getKeys(list), []string{"PT Configured"}) {
+			t.Errorf("Expect only the configured client to be restored, but got %v", getKeys(list))
+		}
+	})
+
+	t.Run("missing snapshot", func(t *testing.T) {
+		restored, err := Restore(validator.NewMemoryStore(nil), filepath.Join(t.TempDir(), "missing.json"), currentTime)
+		if err != nil || restored != 0 {
+			t.Errorf("Expect nothing to be restored without error, but got %v and %v", restored, err)
+		}
+	})
+
+	t.Run("no temporary file is left", func(t *testing.T) {
+		entries, _ := os.ReadDir(filepath.Dir(path))
+		if len(entries) != 1 {
+			t.Errorf("Expect only the snapshot file, but got %v entries", len(entries))
+		}
+	})
+}
+
+func getKeys(data map[string]validator.RateLimiterData) []string {
+	keys := []string{}
+	for key := range data {
+		keys = append(keys, key)
+	}
+	return keys
+}
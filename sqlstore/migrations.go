@@ -0,0 +1,66 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// Migrations of the schema, applied in order at startup
+// The number of applied migrations is kept in the user_version of the database, so only new migrations are applied
+// Existing migrations must never be changed, a change to the schema is done by adding a new migration
+var migrations = []string{
+	// The whole config is kept as JSON, while the main fields are also kept as columns so they can be queried
+	`CREATE TABLE client_configs (
+		client_id TEXT PRIMARY KEY,
+		algorithm TEXT NOT NULL,
+		"limit" INTEGER NOT NULL,
+		window_seconds INTEGER NOT NULL,
+		metadata TEXT NOT NULL DEFAULT '{}',
+		config TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	)`,
+	// Windows can be a fraction of a second. SQLite can not change the type of a column, so the table is created again
+	`CREATE TABLE client_configs_real_window (
+		client_id TEXT PRIMARY KEY,
+		algorithm TEXT NOT NULL,
+		"limit" INTEGER NOT NULL,
+		window_seconds REAL NOT NULL,
+		metadata TEXT NOT NULL DEFAULT '{}',
+		config TEXT NOT NULL,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	INSERT INTO client_configs_real_window (client_id, algorithm, "limit", window_seconds, metadata, config, created_at, updated_at)
+		SELECT client_id, algorithm, "limit", window_seconds, metadata, config, created_at, updated_at FROM client_configs;
+	DROP TABLE client_configs;
+	ALTER TABLE client_configs_real_window RENAME TO client_configs`,
+}
+
+// migrate applies every migration that has not been applied yet, each in its own transaction
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(migrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %v: %w", version+1, err)
+		}
+		// PRAGMA does not support parameters, the version is always a number
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"rate_limiter/validator"
+	"time"
+
+	// Pure Go SQLite driver, so no C compiler is needed to build the rate limiter
+	_ "modernc.org/sqlite"
+)
+
+// ConfigStore keeps the config of every configured client in SQLite, so the configs survive a restart
+// Only configs are kept here, the request counts are changed on every request and stay in memory
+type ConfigStore struct {
+	db *sql.DB
+}
+
+// Config is a client config as it is kept in the database
+type Config struct {
+	Data      validator.CreateData
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Open opens the database at the path, creating it if it does not exist, and applies the migrations
+func Open(path string) (*ConfigStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows a single writer, so a single connection avoids busy errors between connections
+	db.SetMaxOpenConns(1)
+
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &ConfigStore{db: db}, nil
+}
+
+func (s *ConfigStore) Close() error {
+	return s.db.Close()
+}
+
+// Save creates or replaces the config of the client, the created time is kept when the config is replaced
+func (s *ConfigStore) Save(clientID string, data validator.CreateData, currentTime time.Time) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	metadata, err := json.Marshal(data.Metadata)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		INSERT INTO client_configs (client_id, algorithm, "limit", window_seconds, metadata, config, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (client_id) DO UPDATE SET
+			algorithm = excluded.algorithm,
+			"limit" = excluded."limit",
+			window_seconds = excluded.window_seconds,
+			metadata = excluded.metadata,
+			config = excluded.config,
+			updated_at = excluded.updated_at`,
+		clientID, data.Algorithm, data.Limit, data.Window, string(metadata), string(encoded),
+		currentTime.UnixNano(), currentTime.UnixNano(),
+	)
+	return err
+}
+
+// Get returns the config of the client, and false if the client has no config
+func (s *ConfigStore) Get(clientID string) (Config, bool, error) {
+	row := s.db.QueryRow("SELECT client_id, config, created_at, updated_at FROM client_configs WHERE client_id = ?", clientID)
+	_, config, err := scanConfig(row)
+	if err == sql.ErrNoRows {
+		return Config{}, false, nil
+	}
+	return config, err == nil, err
+}
+
+func (s *ConfigStore) Delete(clientID string) error {
+	_, err := s.db.Exec("DELETE FROM client_configs WHERE client_id = ?", clientID)
+	return err
+}
+
+// List returns the config of every client
+func (s *ConfigStore) List() (map[string]Config, error) {
+	rows, err := s.db.Query("SELECT client_id, config, created_at, updated_at FROM client_configs")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	configs := map[string]Config{}
+	for rows.Next() {
+		clientID, config, err := scanConfig(rows)
+		if err != nil {
+			return nil, err
+		}
+		configs[clientID] = config
+	}
+	return configs, rows.Err()
+}
+
+// Restore loads every config into the store, and returns the number of configs loaded
+// The data restored from a snapshot is kept when its config is the same as the one in the database
+// Otherwise the config was changed after the snapshot, and the new config is applied the same way as POST /config
+func (s *ConfigStore) Restore(store validator.Store, currentTime time.Time) (int, error) {
+	configs, err := s.List()
+	if err != nil {
+		return 0, err
+	}
+
+	for clientID, config := range configs {
+		err := store.Update(clientID, func(data validator.RateLimiterData, ok bool) validator.RateLimiterData {
+			if ok && data.Configured && data.UpdatedAt.Equal(config.UpdatedAt) {
+				return data
+			}
+			newData := validator.NewRateLimiterData(config.Data, currentTime)
+			if ok && !config.Data.ResetUsage {
+				newData = validator.UpdateRateLimiterData(data, config.Data, currentTime)
+			}
+			newData.UpdatedAt = config.UpdatedAt
+			return newData
+		})
+		if err != nil {
+			return 0, err
+		}
+	}
+	return len(configs), nil
+}
+
+// scanner is implemented by both sql.Row and sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanConfig(row scanner) (string, Config, error) {
+	var clientID, raw string
+	var createdAt, updatedAt int64
+	if err := row.Scan(&clientID, &raw, &createdAt, &updatedAt); err != nil {
+		return "", Config{}, err
+	}
+
+	config := Config{CreatedAt: time.Unix(0, createdAt), UpdatedAt: time.Unix(0, updatedAt)}
+	err := json.Unmarshal([]byte(raw), &config.Data)
+	return clientID, config, err
+}
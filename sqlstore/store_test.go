@@ -0,0 +1,145 @@
+package sqlstore
+
+import (
+	"database/sql"
+	"path/filepath"
+	"rate_limiter/validator"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T, path string) *ConfigStore {
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Expect no error, but got %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+func TestConfigStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configs.db")
+	currentTime := time.Now()
+	data := validator.CreateData{
+		Limit: 10, Window: 60, Algorithm: validator.AlgorithmSlidingWindow,
+		Limits:   []validator.CreateData{{Limit: 100, Window: 3600}},
+		Metadata: map[string]string{"owner": "payments"},
+	}
+
+	store := openTestStore(t, path)
+	if err := store.Save("PT Config", data, currentTime); err != nil {
+		t.Fatalf("Expect no error, but got %v", err)
+	}
+	// Reopening the database applies the migrations again, which should keep the existing configs
+	store.Close()
+	store = openTestStore(t, path)
+
+	t.Run("config is kept after reopening", func(t *testing.T) {
+		config, ok, err := store.Get("PT Config")
+		if err != nil || !ok {
+			t.Fatalf("Expect config to exist, but got %v and %v", ok, err)
+		}
+
+		if !reflect.DeepEqual(config.Data, data) {
+			t.Errorf("Expect config to be %v, but got %v", data, config.Data)
+		}
+
+		if !config.CreatedAt.Equal(currentTime) || !config.UpdatedAt.Equal(currentTime) {
+			t.Errorf("Expect created and updated time to be %v, but got %v and %v", currentTime, config.CreatedAt, config.UpdatedAt)
+		}
+	})
+
+	t.Run("created time is kept when the config is replaced", func(t *testing.T) {
+		nextTime := currentTime.Add(time.Minute)
+		store.Save("PT Config", validator.CreateData{Limit: 5, Window: 1}, nextTime)
+
+		config, _, _ := store.Get("PT Config")
+		if config.Data.Limit != 5 || !config.CreatedAt.Equal(currentTime) || !config.UpdatedAt.Equal(nextTime) {
+			t.Errorf("Expect replaced config created at %v and updated at %v, but got %v", currentTime, nextTime, config)
+		}
+	})
+
+	t.Run("unknown and deleted client", func(t *testing.T) {
+		store.Delete("PT Config")
+
+		if _, ok, err := store.Get("PT Config"); ok || err != nil {
+			t.Errorf("Expect no config without error, but got %v and %v", ok, err)
+		}
+	})
+}
+
+func TestRestore(t *testing.T) {
+	currentTime := time.Now()
+	store := openTestStore(t, filepath.Join(t.TempDir(), "configs.db"))
+	store.Save("PT Same", validator.CreateData{Limit: 10, Window: 60}, currentTime)
+	store.Save("PT Changed", validator.CreateData{Limit: 20, Window: 60}, currentTime.Add(time.Second))
+
+	// Data restored from a snapshot taken before the config of PT Changed was changed
+	used := validator.NewRateLimiterData(validator.CreateData{Limit: 10, Window: 60}, currentTime)
+	used.Requests = 4
+	memoryStore := validator.NewMemoryStore(map[string]validator.RateLimiterData{"PT Same": used, "PT Changed": used})
+
+	restored, err := store.Restore(memoryStore, currentTime.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Expect no error, but got %v", err)
+	}
+
+	if restored != 2 {
+		t.Errorf("Expect restored configs to be %v, but got %v", 2, restored)
+	}
+
+	t.Run("request count is kept for an unchanged config", func(t *testing.T) {
+		data, _, _ := memoryStore.Get("PT Same")
+		if data.Requests != 4 {
+			t.Errorf("Expect requests to be %v, but got %v", 4, data.Requests)
+		}
+	})
+
+	t.Run("changed config is applied keeping the usage", func(t *testing.T) {
+		data, _, _ := memoryStore.Get("PT Changed")
+		if data.Limit != 20 || data.Requests != 4 || !data.Configured {
+			t.Errorf("Expect new config with limit %v and %v requests, but got %v", 20, 4, data)
+		}
+	})
+}
+
+func TestMigrations(t *testing.T) {
+	t.Run("window is kept as a number of seconds with a fraction", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "configs.db")
+
+		// Create a database with only the first migration applied, as it was before windows could be a fraction of a second
+		db, err := sql.Open("sqlite", "file:"+path)
+		if err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
+		for _, query := range []string{
+			migrations[0],
+			"PRAGMA user_version = 1",
+			`INSERT INTO client_configs (client_id, algorithm, "limit", window_seconds, config, created_at, updated_at)
+				VALUES ('PT Old', '', 10, 60, '{"limit": 10, "window": 60}', 0, 0)`,
+		} {
+			if _, err := db.Exec(query); err != nil {
+				t.Fatalf("Expect no error, but got %v", err)
+			}
+		}
+		db.Close()
+
+		store := openTestStore(t, path)
+		if config, ok, _ := store.Get("PT Old"); !ok || config.Data.Limit != 10 {
+			t.Errorf("Expect existing config to be kept, but got %v", config)
+		}
+
+		store.Save("PT Fraction", validator.CreateData{Limit: 10, Window: 0.5}, time.Now())
+		var window float64
+		if err := store.db.QueryRow("SELECT window_seconds FROM client_configs WHERE client_id = 'PT Fraction'").Scan(&window); err != nil || window != 0.5 {
+			t.Errorf("Expect window to be %v, but got %v (%v)", 0.5, window, err)
+		}
+
+		var columnType string
+		store.db.QueryRow("SELECT type FROM pragma_table_info('client_configs') WHERE name = 'window_seconds'").Scan(&columnType)
+		if columnType != "REAL" {
+			t.Errorf("Expect type of window_seconds to be %v, but got %v", "REAL", columnType)
+		}
+	})
+}
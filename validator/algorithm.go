@@ -0,0 +1,81 @@
+package validator
+
+import (
+	"rate_limiter/config"
+	"time"
+)
+
+// Algorithm decides whether a request is allowed based on the current data of a client
+// Each request has a cost, which is the number of units it takes from the limit
+// The updated data is returned in the result, and it is up to the caller to store it
+type Algorithm interface {
+	Allow(data RateLimiterData, currentTime time.Time, cost int) RateLimitCheckResult
+}
+
+const AlgorithmCounter = "counter"
+
+var algorithms = map[string]Algorithm{
+	AlgorithmCounter:       CounterAlgorithm{},
+	AlgorithmTokenBucket:   TokenBucketAlgorithm{},
+	AlgorithmSlidingLog:    SlidingLogAlgorithm{},
+	AlgorithmSlidingWindow: SlidingWindowAlgorithm{},
+	AlgorithmGCRA:          GCRAAlgorithm{},
+	AlgorithmFixedWindow:   FixedWindowAlgorithm{},
+}
+
+// RegisterAlgorithm makes an algorithm selectable by name in the client config
+// This should be called before serving any request, as the registry is not guarded by a mutex
+func RegisterAlgorithm(name string, algorithm Algorithm) {
+	algorithms[name] = algorithm
+}
+
+// GetAlgorithm returns the algorithm registered under the given name
+// An empty name will return the default algorithm
+func GetAlgorithm(name string) (Algorithm, bool) {
+	if name == "" {
+		name = config.DefaultAlgorithm
+	}
+	algorithm, ok := algorithms[name]
+	return algorithm, ok
+}
+
+// CounterAlgorithm counts the requests made since the first request of the current refresh cycle
+// The refresh cycle starts on the first request after the previous window has passed
+type CounterAlgorithm struct{}
+
+func (CounterAlgorithm) Allow(data RateLimiterData, currentTime time.Time, cost int) RateLimitCheckResult {
+	// If first request has already exceeded the time window, refresh the request to 0
+	if currentTime.Sub(data.FirstRequestTime) > data.Window {
+		data.Requests = 0
+		data.FirstRequestTime = currentTime
+	}
+
+	// Check to see if client has reached the limit
+	// The limit is refreshed once more than the window has passed since the first request
+	if data.Requests+cost > data.Limit {
+		result := RateLimitCheckResult{
+			Status: false, Data: data, Remaining: max(data.Limit-data.Requests, 0),
+			Reset: counterReset(data, currentTime),
+		}
+		if cost <= data.Limit {
+			result.RetryAfter = data.FirstRequestTime.Add(data.Window).Sub(currentTime) + time.Nanosecond
+		}
+		return result
+	}
+
+	// Add to the request count
+	data.Requests += cost
+	return RateLimitCheckResult{
+		Status: true, Data: data, Remaining: data.Limit - data.Requests,
+		Reset: counterReset(data, currentTime),
+	}
+}
+
+// counterReset returns the end of the current window, or the current time when nothing has been used in the window
+// Used by the counter and fixed window algorithms, which both keep the start of the window in FirstRequestTime
+func counterReset(data RateLimiterData, currentTime time.Time) time.Time {
+	if data.Requests == 0 {
+		return currentTime
+	}
+	return data.FirstRequestTime.Add(data.Window)
+}
@@ -0,0 +1,129 @@
+package validator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+type alwaysDenyAlgorithm struct{}
+
+func (alwaysDenyAlgorithm) Allow(data RateLimiterData, currentTime time.Time, cost int) RateLimitCheckResult {
+	return RateLimitCheckResult{Status: false, Data: data}
+}
+
+func TestGetAlgorithm(t *testing.T) {
+	t.Run("empty name returns default algorithm", func(t *testing.T) {
+		algorithm, ok := GetAlgorithm("")
+
+		if !ok {
+			t.Errorf("Expect default algorithm to exist")
+		}
+
+		if _, isCounter := algorithm.(CounterAlgorithm); !isCounter {
+			t.Errorf("Expect default algorithm to be %v, but got %T", AlgorithmCounter, algorithm)
+		}
+	})
+
+	t.Run("unknown algorithm", func(t *testing.T) {
+		expectedStatus := false
+		response := ValidateAlgorithm("unknown")
+
+		if response {
+			t.Errorf("Expect validation to be %v, but got %v", expectedStatus, response)
+		}
+	})
+}
+
+func TestCounterAlgorithm(t *testing.T) {
+	t.Run("limit reached", func(t *testing.T) {
+		currentTime := time.Now()
+		data := RateLimiterData{Policy: Policy{Limit: 3, Window: 5 * time.Second}, Usage: Usage{Requests: 3, FirstRequestTime: currentTime}}
+
+		response := CounterAlgorithm{}.Allow(data, currentTime.Add(time.Second), 1)
+
+		if response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", false, response.Status)
+		}
+
+		if !reflect.DeepEqual(response.Data, data) {
+			t.Errorf("Expected data to be unchanged %v, but got %v", data, response.Data)
+		}
+
+		if response.RetryAfter != 4*time.Second+time.Nanosecond {
+			t.Errorf("Expect retry after to be %v, but got %v", 4*time.Second+time.Nanosecond, response.RetryAfter)
+		}
+	})
+
+	t.Run("limit refreshed after window", func(t *testing.T) {
+		currentTime := time.Now()
+		data := RateLimiterData{Policy: Policy{Limit: 3, Window: 5 * time.Second}, Usage: Usage{Requests: 3, FirstRequestTime: currentTime}}
+		nextTime := currentTime.Add(6 * time.Second)
+
+		response := CounterAlgorithm{}.Allow(data, nextTime, 1)
+
+		if !response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", true, response.Status)
+		}
+
+		if response.Data.Requests != 1 || response.Data.FirstRequestTime != nextTime {
+			t.Errorf("Expected refreshed data, but got %v", response.Data)
+		}
+	})
+}
+
+func TestCounterAlgorithmCost(t *testing.T) {
+	t.Run("cost above remaining units", func(t *testing.T) {
+		currentTime := time.Now()
+		data := RateLimiterData{Policy: Policy{Limit: 100, Window: 5 * time.Second}, Usage: Usage{Requests: 45, FirstRequestTime: currentTime}}
+
+		response := CounterAlgorithm{}.Allow(data, currentTime, 50)
+		if !response.Status || response.Remaining != 5 {
+			t.Errorf("Expect request to be allowed with %v remaining, but got %v and %v", 5, response.Status, response.Remaining)
+		}
+
+		response = CounterAlgorithm{}.Allow(response.Data, currentTime, 50)
+		if response.Status || response.Remaining != 5 {
+			t.Errorf("Expect request to be limited with %v remaining, but got %v and %v", 5, response.Status, response.Remaining)
+		}
+
+		response = CounterAlgorithm{}.Allow(response.Data, currentTime, 5)
+		if !response.Status || response.Remaining != 0 {
+			t.Errorf("Expect request to be allowed with %v remaining, but got %v and %v", 0, response.Status, response.Remaining)
+		}
+	})
+
+	t.Run("cost above limit is never allowed", func(t *testing.T) {
+		currentTime := time.Now()
+		data := RateLimiterData{Policy: Policy{Limit: 10, Window: 5 * time.Second}, Usage: Usage{FirstRequestTime: currentTime}}
+
+		response := CounterAlgorithm{}.Allow(data, currentTime, 11)
+
+		if response.Status || response.RetryAfter != 0 {
+			t.Errorf("Expect request to be limited without retry after, but got %v and %v", response.Status, response.RetryAfter)
+		}
+	})
+}
+
+func TestValidateRequestLimitAlgorithm(t *testing.T) {
+	t.Run("uses algorithm from client data", func(t *testing.T) {
+		RegisterAlgorithm("always deny", alwaysDenyAlgorithm{})
+		defer delete(algorithms, "always deny")
+
+		currentTime := time.Now()
+		clientId := "PT Deny"
+		data := map[string]RateLimiterData{
+			clientId: {Policy: Policy{Limit: 3, Window: 5 * time.Second, Algorithm: "always deny"}, Usage: Usage{Requests: 0, FirstRequestTime: currentTime}},
+		}
+		rateLimiter := RateLimiter{}
+
+		response, err := rateLimiter.ValidateRequestLimit(clientId, currentTime, NewMemoryStore(data))
+		if err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
+
+		if response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", false, response.Status)
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package validator
+
+import (
+	"rate_limiter/config"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// AtomicCounterStore keeps the data of every client in memory, the same as MemoryStore,
+// but checks the limit of clients using the counter algorithm without taking any lock
+// The request count is kept in an atomic integer and only increased with compare-and-swap, so a request is never allowed above the limit
+// Clients using other algorithms or additional limits are updated through Update, which is serialized per client
+type AtomicCounterStore struct {
+	// Maps the clientID to an *atomicClient
+	clients sync.Map
+}
+
+type atomicClient struct {
+	// Serializes Update, Delete and Evict of the client, the counter is checked without it
+	mutex sync.Mutex
+	// nil once the client is removed from the store
+	state atomic.Pointer[counterState]
+}
+
+// counterState is replaced as a whole when the window is refreshed or the client is updated
+// Only the request count is changed in place. An update keeps the same count, so requests counted during the update are not lost
+type counterState struct {
+	data     RateLimiterData
+	requests *atomic.Int64
+}
+
+func newCounterState(data RateLimiterData) *counterState {
+	state := &counterState{data: data, requests: &atomic.Int64{}}
+	state.requests.Store(int64(data.Requests))
+	return state
+}
+
+func (state *counterState) load() RateLimiterData {
+	data := state.data
+	data.Requests = int(state.requests.Load())
+	return data
+}
+
+func newAtomicClient(data RateLimiterData) *atomicClient {
+	client := &atomicClient{}
+	client.state.Store(newCounterState(data))
+	return client
+}
+
+// NewAtomicCounterStore creates a store containing a copy of the given data
+func NewAtomicCounterStore(data map[string]RateLimiterData) *AtomicCounterStore {
+	store := &AtomicCounterStore{}
+	for clientID, clientData := range data {
+		store.clients.Store(clientID, newAtomicClient(clientData))
+	}
+	return store
+}
+
+func (s *AtomicCounterStore) Get(clientID string) (RateLimiterData, bool, error) {
+	value, ok := s.clients.Load(clientID)
+	if !ok {
+		return RateLimiterData{}, false, nil
+	}
+	state := value.(*atomicClient).state.Load()
+	if state == nil {
+		return RateLimiterData{}, false, nil
+	}
+	return state.load(), true, nil
+}
+
+// Update replaces the data of the client, including its request count
+// Requests counted by CheckRequestLimit while the update is made are added to the request count returned by update
+func (s *AtomicCounterStore) Update(clientID string, update func(data RateLimiterData, ok bool) RateLimiterData) error {
+	for {
+		value, ok := s.clients.Load(clientID)
+		if !ok {
+			if _, loaded := s.clients.LoadOrStore(clientID, newAtomicClient(update(RateLimiterData{}, false))); !loaded {
+				return nil
+			}
+			// Another request created the client in the meantime
+			continue
+		}
+
+		if updateAtomicClient(value.(*atomicClient), update) {
+			return nil
+		}
+		// The client was removed in the meantime
+	}
+}
+
+// updateAtomicClient applies the update to the client, and returns false if the client has been removed
+func updateAtomicClient(client *atomicClient, update func(data RateLimiterData, ok bool) RateLimiterData) bool {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	for {
+		state := client.state.Load()
+		if state == nil {
+			return false
+		}
+
+		// The new state keeps the same counter, changed by the difference between the request count returned by update and the one it received
+		// The count is raised before and lowered after the state is replaced, so no request is allowed above the limit of either state in between
+		data := state.load()
+		newState := &counterState{data: update(data, true), requests: state.requests}
+		difference := int64(newState.data.Requests - data.Requests)
+		if difference > 0 {
+			state.requests.Add(difference)
+		}
+
+		// The window may be refreshed by a request in the meantime, in which case the update is made again
+		if !client.state.CompareAndSwap(state, newState) {
+			if difference > 0 {
+				state.requests.Add(-difference)
+			}
+			continue
+		}
+		if difference < 0 {
+			state.requests.Add(difference)
+		}
+		return true
+	}
+}
+
+func (s *AtomicCounterStore) Delete(clientID string) error {
+	value, ok := s.clients.Load(clientID)
+	if !ok {
+		return nil
+	}
+
+	client := value.(*atomicClient)
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	client.state.Store(nil)
+	s.clients.CompareAndDelete(clientID, client)
+	return nil
+}
+
+func (s *AtomicCounterStore) List() (map[string]RateLimiterData, error) {
+	data := map[string]RateLimiterData{}
+	s.clients.Range(func(key, value any) bool {
+		if state := value.(*atomicClient).state.Load(); state != nil {
+			data[key.(string)] = state.load()
+		}
+		return true
+	})
+	return data, nil
+}
+
+// Evict removes idle clients created from the default values, the same as MemoryStore.Evict
+func (s *AtomicCounterStore) Evict(currentTime time.Time) (int, error) {
+	evicted := 0
+	s.clients.Range(func(key, value any) bool {
+		client := value.(*atomicClient)
+		client.mutex.Lock()
+		defer client.mutex.Unlock()
+
+		state := client.state.Load()
+		if state == nil || state.data.Configured {
+			return true
+		}
+		requests := state.requests.Load()
+		data := state.data
+		data.Requests = int(requests)
+		if !IsExpired(data, currentTime) || !client.state.CompareAndSwap(state, nil) {
+			return true
+		}
+
+		// A request was counted before the client was removed, so the client is kept
+		if state.requests.Load() != requests {
+			client.state.Store(state)
+			return true
+		}
+		s.clients.CompareAndDelete(key, client)
+		evicted++
+		return true
+	})
+	EvictedClients.Add(int64(evicted))
+	return evicted, nil
+}
+
+// CheckRequestLimit checks the limit of clients using the counter algorithm without additional limits, with the same behaviour as CounterAlgorithm
+// Nothing is logged, as the logger takes a lock
+func (s *AtomicCounterStore) CheckRequestLimit(clientID string, currentTime time.Time, cost int) (RateLimitCheckResult, bool, error) {
+	for {
+		value, ok := s.clients.Load(clientID)
+		if !ok {
+			// New clients start from the default values, the same as ValidateRequestLimit
+			client := newAtomicClient(NewDefaultRateLimiterData(currentTime))
+			value, _ = s.clients.LoadOrStore(clientID, client)
+		}
+
+		result, handled, removed := checkAtomicCounter(value.(*atomicClient), currentTime, cost)
+		if !removed {
+			return result, handled, nil
+		}
+		// The client was removed in the meantime, the request is checked against the new client
+	}
+}
+
+// checkAtomicCounter checks the limit of the client, and returns true as the last value if the client was removed while checking
+func checkAtomicCounter(client *atomicClient, currentTime time.Time, cost int) (RateLimitCheckResult, bool, bool) {
+	for {
+		state := client.state.Load()
+		if state == nil {
+			return RateLimitCheckResult{}, false, true
+		}
+
+		data := state.data
+		algorithm := data.Algorithm
+		if algorithm == "" {
+			algorithm = config.DefaultAlgorithm
+		}
+		if algorithm != AlgorithmCounter || len(data.Limits) > 0 {
+			return RateLimitCheckResult{}, false, false
+		}
+
+		// If first request has already exceeded the time window, start a new window
+		// Only one request is able to replace the state, the others check the limit again using the new state
+		if currentTime.Sub(data.FirstRequestTime) > data.Window {
+			data.Requests = 0
+			data.FirstRequestTime = currentTime
+			client.state.CompareAndSwap(state, newCounterState(data))
+			continue
+		}
+
+		requests := state.requests.Load()
+		data.Requests = int(requests)
+		if data.Requests+cost > data.Limit {
+			result := RateLimitCheckResult{
+				Status: false, Data: data, Remaining: max(data.Limit-data.Requests, 0), Limit: data.Limit,
+				Reset: counterReset(data, currentTime), LimitReset: counterReset(data, currentTime), LimitName: data.LimitName(),
+			}
+			if cost <= data.Limit {
+				result.RetryAfter = data.FirstRequestTime.Add(data.Window).Sub(currentTime) + time.Nanosecond
+			}
+			return result, true, false
+		}
+
+		if !state.requests.CompareAndSwap(requests, requests+int64(cost)) {
+			continue
+		}
+		// The state may have been replaced while the request was counted, in which case the count could be lost
+		// The request is taken back from the old state and counted again using the new state
+		if client.state.Load() != state {
+			state.requests.Add(-int64(cost))
+			continue
+		}
+
+		data.Requests += cost
+		return RateLimitCheckResult{
+			Status: true, Data: data, Remaining: data.Limit - data.Requests, Limit: data.Limit,
+			Reset: counterReset(data, currentTime), LimitReset: counterReset(data, currentTime),
+		}, true, false
+	}
+}
@@ -0,0 +1,265 @@
+package validator
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestAtomicCounterStore(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Run("same results as the counter algorithm", func(t *testing.T) {
+		currentTime := time.Now()
+		data := map[string]RateLimiterData{
+			"PT A": {Policy: Policy{Limit: 5, Window: 5 * time.Second}, Usage: Usage{Requests: 0, FirstRequestTime: currentTime}},
+		}
+		memoryStore := NewMemoryStore(data)
+		atomicStore := NewAtomicCounterStore(data)
+		rateLimiter := RateLimiter{}
+
+		steps := []struct {
+			clientID string
+			offset   time.Duration
+			cost     int
+		}{
+			{"PT A", 0, 1}, {"PT A", time.Second, 3}, {"PT A", time.Second, 2}, {"PT A", 2 * time.Second, 1},
+			{"PT A", 2 * time.Second, 6}, {"PT A", 5 * time.Second, 1}, {"PT A", 6 * time.Second, 5}, {"PT A", 7 * time.Second, 1},
+			{"PT New", 0, 1}, {"PT New", time.Second, 3}, {"PT New", 6 * time.Second, 1},
+		}
+		for i, step := range steps {
+			expected, _ := rateLimiter.ValidateRequestLimitN(step.clientID, currentTime.Add(step.offset), step.cost, memoryStore)
+			response, err := rateLimiter.ValidateRequestLimitN(step.clientID, currentTime.Add(step.offset), step.cost, atomicStore)
+			if err != nil {
+				t.Fatalf("Expect no error, but got %v", err)
+			}
+
+			if !reflect.DeepEqual(response, expected) {
+				t.Errorf("Expect step %v to be %+v, but got %+v", i, expected, response)
+			}
+		}
+
+		expectedList, _ := memoryStore.List()
+		list, _ := atomicStore.List()
+		if !reflect.DeepEqual(list, expectedList) {
+			t.Errorf("Expect stored data to be %v, but got %v", expectedList, list)
+		}
+	})
+
+	t.Run("other algorithms are updated through the store", func(t *testing.T) {
+		currentTime := time.Now()
+		store := NewAtomicCounterStore(map[string]RateLimiterData{
+			"PT Sliding": {Policy: Policy{Limit: 1, Window: 5 * time.Second, Algorithm: AlgorithmSlidingWindow}, Usage: Usage{FirstRequestTime: currentTime}},
+		})
+
+		if _, handled, _ := store.CheckRequestLimit("PT Sliding", currentTime, 1); handled {
+			t.Errorf("Expect sliding window client to not be handled by the counter")
+		}
+
+		rateLimiter := RateLimiter{}
+		rateLimiter.ValidateRequestLimit("PT Sliding", currentTime, store)
+		if response, _ := rateLimiter.ValidateRequestLimit("PT Sliding", currentTime, store); response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", false, response.Status)
+		}
+	})
+
+	t.Run("delete and evict", func(t *testing.T) {
+		currentTime := time.Now()
+		store := NewAtomicCounterStore(map[string]RateLimiterData{
+			"PT Idle":       {Policy: Policy{Limit: 3, Window: 5 * time.Second}, Usage: Usage{Requests: 3, FirstRequestTime: currentTime.Add(-time.Minute)}},
+			"PT Configured": {Policy: Policy{Limit: 3, Window: 5 * time.Second, Configured: true}, Usage: Usage{Requests: 3, FirstRequestTime: currentTime.Add(-time.Minute)}},
+			"PT Deleted":    {Policy: Policy{Limit: 3, Window: 5 * time.Second}, Usage: Usage{Requests: 1, FirstRequestTime: currentTime}},
+		})
+		store.Delete("PT Deleted")
+
+		if evicted, _ := store.Evict(currentTime); evicted != 1 {
+			t.Errorf("Expect evicted clients to be %v, but got %v", 1, evicted)
+		}
+
+		list, _ := store.List()
+		if _, ok := list["PT Configured"]; !ok || len(list) != 1 {
+			t.Errorf("Expect only the configured client to be kept, but got %v", list)
+		}
+	})
+}
+
+// Run with -race, many requests for the same client are made at once and no window may allow more than the limit
+func TestAtomicCounterStoreConcurrent(t *testing.T) {
+	log.SetOutput(io.Discard)
+	const limit = 50
+	const goroutines = 16
+	const requestsPerWindow = 20
+	const windows = 20
+	currentTime := time.Now()
+	window := time.Second
+	store := NewAtomicCounterStore(map[string]RateLimiterData{
+		"PT Stress": {Policy: Policy{Limit: limit, Window: window}, Usage: Usage{FirstRequestTime: currentTime}},
+	})
+
+	var mutex sync.Mutex
+	allowedPerWindow := map[time.Time]int{}
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rateLimiter := RateLimiter{}
+			for w := 0; w < windows; w++ {
+				requestTime := currentTime.Add(time.Duration(w) * (window + time.Nanosecond))
+				for i := 0; i < requestsPerWindow; i++ {
+					response, err := rateLimiter.ValidateRequestLimit("PT Stress", requestTime, store)
+					if err != nil {
+						t.Errorf("Expect no error, but got %v", err)
+						return
+					}
+					if response.Status {
+						mutex.Lock()
+						allowedPerWindow[response.Data.FirstRequestTime]++
+						mutex.Unlock()
+					}
+
+					// Change the config while other goroutines are still counting requests, keeping the usage of the client
+					if i%5 == 0 {
+						store.Update("PT Stress", func(data RateLimiterData, ok bool) RateLimiterData {
+							if !ok {
+								return RateLimiterData{Policy: Policy{Limit: limit, Window: window}, Usage: Usage{FirstRequestTime: requestTime}}
+							}
+							data.Name = fmt.Sprintf("PT Stress %v", i)
+							return data
+						})
+					}
+				}
+				// Remove the client while other goroutines are still counting requests
+				store.Evict(requestTime.Add(window))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for start, allowed := range allowedPerWindow {
+		if allowed > limit {
+			t.Errorf("Expect at most %v requests in the window starting at %v, but got %v", limit, start, allowed)
+		}
+	}
+}
+
+func TestAtomicCounterStoreExactLimit(t *testing.T) {
+	t.Run("exactly the limit is allowed under contention", func(t *testing.T) {
+		const limit = 1000
+		currentTime := time.Now()
+		store := NewAtomicCounterStore(map[string]RateLimiterData{
+			"PT Exact": {Policy: Policy{Limit: limit, Window: time.Hour}, Usage: Usage{FirstRequestTime: currentTime}},
+		})
+
+		var allowed atomic.Int64
+		var wg sync.WaitGroup
+		for g := 0; g < 32; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 100; i++ {
+					if response, _, _ := store.CheckRequestLimit("PT Exact", currentTime, 1); response.Status {
+						allowed.Add(1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+
+		if allowed.Load() != limit {
+			t.Errorf("Expect allowed requests to be %v, but got %v", limit, allowed.Load())
+		}
+	})
+
+	t.Run("requests counted while the client is updated are kept", func(t *testing.T) {
+		const limit = 100
+		currentTime := time.Now()
+		store := NewAtomicCounterStore(map[string]RateLimiterData{
+			"PT Updated": {Policy: Policy{Limit: limit, Window: time.Hour}, Usage: Usage{FirstRequestTime: currentTime}},
+		})
+
+		// The config is changed continuously while requests are made, keeping the usage of the client
+		done := make(chan struct{})
+		var updates sync.WaitGroup
+		updates.Add(1)
+		go func() {
+			defer updates.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				store.Update("PT Updated", func(data RateLimiterData, ok bool) RateLimiterData {
+					data.Name = fmt.Sprintf("PT Updated %v", i)
+					return data
+				})
+			}
+		}()
+
+		var allowed atomic.Int64
+		var wg sync.WaitGroup
+		for g := 0; g < 16; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 50; i++ {
+					if response, _, _ := store.CheckRequestLimit("PT Updated", currentTime, 1); response.Status {
+						allowed.Add(1)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(done)
+		updates.Wait()
+
+		if allowed.Load() != limit {
+			t.Errorf("Expect allowed requests to be %v, but got %v", limit, allowed.Load())
+		}
+
+		if data, _, _ := store.Get("PT Updated"); data.Requests != limit {
+			t.Errorf("Expect request count to be %v, but got %v", limit, data.Requests)
+		}
+	})
+}
+
+func BenchmarkCounterStore(b *testing.B) {
+	log.SetOutput(io.Discard)
+	stores := []struct {
+		name     string
+		newStore func() Store
+	}{
+		{"memory", func() Store { return NewMemoryStore(nil) }},
+		{"atomic", func() Store { return NewAtomicCounterStore(nil) }},
+	}
+	for _, s := range stores {
+		for _, sameClient := range []bool{true, false} {
+			b.Run(fmt.Sprintf("%v same client %v", s.name, sameClient), func(b *testing.B) {
+				store := s.newStore()
+				rateLimiter := RateLimiter{}
+				var clients atomic.Int64
+				currentTime := time.Now()
+
+				b.RunParallel(func(pb *testing.PB) {
+					// The limit is high enough that every request is allowed
+					clientID := "PT Shared"
+					if !sameClient {
+						clientID = fmt.Sprintf("PT %v", clients.Add(1))
+					}
+					store.Update(clientID, func(RateLimiterData, bool) RateLimiterData {
+						return RateLimiterData{Policy: Policy{Limit: math.MaxInt, Window: time.Hour}, Usage: Usage{FirstRequestTime: currentTime}}
+					})
+					for pb.Next() {
+						rateLimiter.ValidateRequestLimit(clientID, currentTime, store)
+					}
+				})
+			})
+		}
+	}
+}
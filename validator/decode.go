@@ -0,0 +1,171 @@
+package validator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// FieldError is the reason a field of a config is invalid
+type FieldError struct {
+	// Path of the field, for example "limits[0].window", empty when the error is about the whole body
+	Field   string `json:"field,omitempty"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+}
+
+// Reasons a field of a config is invalid
+const (
+	ReasonMalformedJSON = "malformed_json"
+	ReasonUnknownField  = "unknown_field"
+	ReasonWrongType     = "wrong_type"
+	ReasonOutOfRange    = "out_of_range"
+	ReasonInvalidValue  = "invalid_value"
+)
+
+var createDataType = reflect.TypeOf(CreateData{})
+
+// DecodeConfig decodes a single JSON config from the body into data, and returns an error for every field that can not be decoded
+// Unknown fields and data after the config are rejected, so a typo in a field name is not silently ignored
+// Fields that are not in the body keep their value in data, see PatchConfig to only change the fields provided
+func DecodeConfig(body io.Reader, data *CreateData) []FieldError {
+	_, errs := decodeConfig(body, data)
+	return errs
+}
+
+// PatchConfig decodes a partial config from the body, and replaces the fields of data that are in the body
+// Each field is replaced as a whole, so the metadata and additional limits of the body replace the current ones rather than being merged
+// data is not changed when the body is invalid
+func PatchConfig(body io.Reader, data *CreateData) []FieldError {
+	var patch CreateData
+	raw, errs := decodeConfig(body, &patch)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	// The body is known to be an object once it is decoded
+	var object map[string]json.RawMessage
+	json.Unmarshal(raw, &object)
+
+	current := reflect.ValueOf(data).Elem()
+	patched := reflect.ValueOf(patch)
+	for i := 0; i < createDataType.NumField(); i++ {
+		if _, ok := object[jsonName(createDataType.Field(i))]; ok {
+			current.Field(i).Set(patched.Field(i))
+		}
+	}
+	return nil
+}
+
+// decodeConfig decodes the body into data, and returns the JSON object of the body
+func decodeConfig(body io.Reader, data *CreateData) (json.RawMessage, []FieldError) {
+	decoder := json.NewDecoder(body)
+	var raw json.RawMessage
+	if err := decoder.Decode(&raw); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, []FieldError{{Reason: ReasonMalformedJSON, Message: "body must not be empty"}}
+		}
+		return nil, []FieldError{{Reason: ReasonMalformedJSON, Message: fmt.Sprintf("body is not valid JSON: %v", err)}}
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return nil, []FieldError{{Reason: ReasonMalformedJSON, Message: "body must only contain a single JSON object"}}
+	}
+
+	// Every field is checked on its own first, so all invalid fields are reported rather than only the first one
+	if errs := decodeErrors(raw, createDataType, ""); len(errs) > 0 {
+		return nil, errs
+	}
+
+	decoder = json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(data); err != nil {
+		return nil, []FieldError{{Reason: ReasonMalformedJSON, Message: err.Error()}}
+	}
+	return raw, nil
+}
+
+// jsonName returns the name of the field in JSON, or an empty string if the field is not in JSON
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// decodeErrors checks every field of the JSON object can be decoded into the field of the struct with the same JSON name
+func decodeErrors(raw json.RawMessage, structType reflect.Type, path string) []FieldError {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err != nil || object == nil {
+		return []FieldError{{Field: strings.TrimSuffix(path, "."), Reason: ReasonWrongType, Message: "must be an object"}}
+	}
+
+	fields := map[string]reflect.Type{}
+	for i := 0; i < structType.NumField(); i++ {
+		if name := jsonName(structType.Field(i)); name != "" {
+			fields[name] = structType.Field(i).Type
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	errs := []FieldError{}
+	for _, name := range names {
+		fieldType, ok := fields[name]
+		if !ok {
+			errs = append(errs, FieldError{Field: path + name, Reason: ReasonUnknownField, Message: "is not a known field"})
+			continue
+		}
+
+		// Additional limits are checked one by one, so the error contains the position of the invalid limit
+		if fieldType.Kind() == reflect.Slice && fieldType.Elem() == structType {
+			var items []json.RawMessage
+			if err := json.Unmarshal(object[name], &items); err != nil {
+				errs = append(errs, FieldError{Field: path + name, Reason: ReasonWrongType, Message: "must be an array of objects"})
+				continue
+			}
+			for i, item := range items {
+				errs = append(errs, decodeErrors(item, structType, fmt.Sprintf("%v%v[%v].", path, name, i))...)
+			}
+			continue
+		}
+
+		if err := json.Unmarshal(object[name], reflect.New(fieldType).Interface()); err != nil {
+			errs = append(errs, FieldError{Field: path + name, Reason: ReasonWrongType, Message: "must be " + typeName(fieldType)})
+		}
+	}
+	return errs
+}
+
+// typeName describes the JSON value expected for a type
+func typeName(fieldType reflect.Type) string {
+	switch fieldType {
+	case reflect.TypeOf(Seconds(0)):
+		return `a number of seconds or a duration string, for example 60 or "15m"`
+	case reflect.TypeOf(&Rate{}):
+		return `a rate written as <limit>/<window>, for example "100/min"`
+	}
+
+	switch fieldType.Kind() {
+	case reflect.Int:
+		return "an integer"
+	case reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Map:
+		return "an object of strings"
+	}
+	return fieldType.String()
+}
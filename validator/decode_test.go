@@ -0,0 +1,166 @@
+package validator
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeConfig(t *testing.T) {
+	t.Run("valid config", func(t *testing.T) {
+		var data CreateData
+		errs := DecodeConfig(strings.NewReader(`{"limit": 10, "window": "1m", "limits": [{"rate": "100/hour"}]}`), &data)
+
+		if len(errs) != 0 {
+			t.Fatalf("Expect errors to be %v, but got %v", 0, errs)
+		}
+		if data.Limit != 10 || data.Window.Duration() != time.Minute || data.Limits[0].Rate == nil {
+			t.Errorf("Expect config to be decoded, but got %v", data)
+		}
+	})
+
+	t.Run("fields not in the body are kept", func(t *testing.T) {
+		data := CreateData{Limit: 10, Window: 60}
+		DecodeConfig(strings.NewReader(`{"limit": 20}`), &data)
+
+		if data.Limit != 20 || data.Window != 60 {
+			t.Errorf("Expect config to be %v per %v, but got %v per %v", 20, 60, data.Limit, data.Window)
+		}
+	})
+
+	t.Run("every invalid field is reported", func(t *testing.T) {
+		data := CreateData{Limit: 10, Window: 60}
+		errs := DecodeConfig(strings.NewReader(`{
+			"limit": 1.5,
+			"algorithm": 1,
+			"limts": [],
+			"limits": [{"window": "soon"}, "hourly"]
+		}`), &data)
+		expected := []FieldError{
+			{Field: "algorithm", Reason: ReasonWrongType, Message: "must be a string"},
+			{Field: "limit", Reason: ReasonWrongType, Message: "must be an integer"},
+			{Field: "limits[0].window", Reason: ReasonWrongType, Message: `must be a number of seconds or a duration string, for example 60 or "15m"`},
+			{Field: "limits[1]", Reason: ReasonWrongType, Message: "must be an object"},
+			{Field: "limts", Reason: ReasonUnknownField, Message: "is not a known field"},
+		}
+
+		if !reflect.DeepEqual(errs, expected) {
+			t.Errorf("Expect errors to be %v, but got %v", expected, errs)
+		}
+		if data.Limit != 10 {
+			t.Errorf("Expect limit to stay %v, but got %v", 10, data.Limit)
+		}
+	})
+
+	t.Run("malformed body", func(t *testing.T) {
+		for _, body := range []string{``, `{"limit": `, `[]`, `{"limit": 1} x`, `{"limit": 1}{}`} {
+			var data CreateData
+			errs := DecodeConfig(strings.NewReader(body), &data)
+
+			if len(errs) != 1 {
+				t.Errorf("Expect errors of %q to be %v, but got %v", body, 1, errs)
+			}
+		}
+	})
+}
+
+func TestPatchConfig(t *testing.T) {
+	t.Run("fields in the body are replaced as a whole", func(t *testing.T) {
+		data := CreateData{
+			Limit: 10, Window: 60, Metadata: map[string]string{"team": "search"},
+			Limits: []CreateData{{Algorithm: AlgorithmTokenBucket, Capacity: 5, RefillPerSecond: 1}},
+		}
+		errs := PatchConfig(strings.NewReader(`{"metadata": {"owner": "platform"}, "limits": [{"limit": 3, "window": 1}]}`), &data)
+		expected := CreateData{Limit: 10, Window: 60, Metadata: map[string]string{"owner": "platform"}, Limits: []CreateData{{Limit: 3, Window: 1}}}
+
+		if len(errs) != 0 {
+			t.Fatalf("Expect errors to be %v, but got %v", 0, errs)
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("Expect config to be %+v, but got %+v", expected, data)
+		}
+	})
+
+	t.Run("invalid body does not change the config", func(t *testing.T) {
+		data := CreateData{Limit: 10, Window: 60, Metadata: map[string]string{"team": "search"}}
+		errs := PatchConfig(strings.NewReader(`{"metadata": {"evil": "y"}, "limit": "high"}`), &data)
+		expected := CreateData{Limit: 10, Window: 60, Metadata: map[string]string{"team": "search"}}
+
+		if len(errs) != 1 {
+			t.Errorf("Expect errors to be %v, but got %v", 1, errs)
+		}
+		if !reflect.DeepEqual(data, expected) {
+			t.Errorf("Expect config to be %+v, but got %+v", expected, data)
+		}
+	})
+}
+
+func TestConfigErrors(t *testing.T) {
+	t.Run("every invalid field is reported with its path", func(t *testing.T) {
+		errs := ConfigErrors(CreateData{
+			Limit: 0, Window: 60, MaxWait: -1,
+			Limits: []CreateData{{Algorithm: AlgorithmTokenBucket, Limits: []CreateData{{Limit: 1, Window: 1}}}},
+		})
+		expected := []FieldError{
+			{Field: "max_wait", Reason: ReasonOutOfRange, Message: "must not be negative"},
+			{Field: "limit", Reason: ReasonOutOfRange, Message: "must be greater than 0"},
+			{Field: "limits[0].limits", Reason: ReasonInvalidValue, Message: "additional limits can not contain further limits"},
+			{Field: "limits[0].capacity", Reason: ReasonOutOfRange, Message: "must be greater than 0"},
+			{Field: "limits[0].refill_per_second", Reason: ReasonOutOfRange, Message: "must be greater than 0"},
+		}
+
+		if !reflect.DeepEqual(errs, expected) {
+			t.Errorf("Expect errors to be %v, but got %v", expected, errs)
+		}
+	})
+
+	t.Run("fields of the whole client are rejected in additional limits", func(t *testing.T) {
+		errs := ConfigErrors(CreateData{
+			Limit: 10, Window: 60,
+			Limits: []CreateData{{Limit: 1, Window: 1, MaxWait: 5, MaxInFlight: 2, Metadata: map[string]string{"team": "search"}, ResetUsage: true}},
+		})
+		expected := []FieldError{
+			{Field: "limits[0].max_wait", Reason: ReasonInvalidValue, Message: "is only supported for the whole client, not in additional limits"},
+			{Field: "limits[0].max_in_flight", Reason: ReasonInvalidValue, Message: "is only supported for the whole client, not in additional limits"},
+			{Field: "limits[0].metadata", Reason: ReasonInvalidValue, Message: "is only supported for the whole client, not in additional limits"},
+			{Field: "limits[0].reset_usage", Reason: ReasonInvalidValue, Message: "is only supported for the whole client, not in additional limits"},
+		}
+
+		if !reflect.DeepEqual(errs, expected) {
+			t.Errorf("Expect errors to be %v, but got %v", expected, errs)
+		}
+	})
+
+	t.Run("windows under a millisecond are rejected", func(t *testing.T) {
+		errs := ConfigErrors(CreateData{Limit: 10, Window: 0.0005, Limits: []CreateData{{Algorithm: AlgorithmFixedWindow, Limit: 1, Window: 0.000001}}})
+		expected := []FieldError{
+			{Field: "window", Reason: ReasonOutOfRange, Message: "must be at least 1ms"},
+			{Field: "limits[0].window", Reason: ReasonOutOfRange, Message: "must be at least 1ms"},
+		}
+
+		if !reflect.DeepEqual(errs, expected) {
+			t.Errorf("Expect errors to be %v, but got %v", expected, errs)
+		}
+	})
+
+	t.Run("gcra limits with less than a nanosecond between requests are rejected", func(t *testing.T) {
+		errs := ConfigErrors(CreateData{Algorithm: AlgorithmGCRA, Limit: 1000001, Window: 0.001})
+		expected := []FieldError{
+			{Field: "limit", Reason: ReasonOutOfRange, Message: "must be at most the number of nanoseconds in the window (1000000) for the gcra algorithm"},
+		}
+
+		if !reflect.DeepEqual(errs, expected) {
+			t.Errorf("Expect errors to be %v, but got %v", expected, errs)
+		}
+		if errs := ConfigErrors(CreateData{Algorithm: AlgorithmGCRA, Limit: 1000000, Window: 0.001}); len(errs) != 0 {
+			t.Errorf("Expect errors to be %v, but got %v", 0, errs)
+		}
+	})
+
+	t.Run("valid config", func(t *testing.T) {
+		if errs := ConfigErrors(CreateData{Limit: 10, Window: 0.5}); len(errs) != 0 {
+			t.Errorf("Expect errors to be %v, but got %v", 0, errs)
+		}
+	})
+}
@@ -0,0 +1,116 @@
+package validator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Seconds is a duration in the config, kept as a number of seconds so existing configs keep the same meaning
+// In JSON it is either a number of seconds (60, 0.5) or a duration string ("500ms", "15m", "1h")
+type Seconds float64
+
+// Duration converts the seconds to a duration, rounded to the nearest nanosecond
+func (s Seconds) Duration() time.Duration {
+	return time.Duration(math.Round(float64(s) * float64(time.Second)))
+}
+
+func (s *Seconds) UnmarshalJSON(raw []byte) error {
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		var seconds float64
+		if err := json.Unmarshal(raw, &seconds); err != nil {
+			return fmt.Errorf("validator: duration must be a number of seconds or a duration string: %s", raw)
+		}
+		*s = Seconds(seconds)
+		return nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("validator: invalid duration %q", value)
+	}
+	*s = Seconds(duration.Seconds())
+	return nil
+}
+
+// Rate is a limit and its window written as a single string, for example "100/min" or "10/500ms"
+type Rate struct {
+	Limit  int
+	Window Seconds
+}
+
+// Units that can be used instead of a duration in a rate, so "100/min" can be used instead of "100/1m"
+var rateUnits = map[string]time.Duration{
+	"s": time.Second, "sec": time.Second, "second": time.Second,
+	"m": time.Minute, "min": time.Minute, "minute": time.Minute,
+	"h": time.Hour, "hr": time.Hour, "hour": time.Hour,
+	"d": 24 * time.Hour, "day": 24 * time.Hour,
+}
+
+// ParseRate parses a rate written as <limit>/<unit or duration>
+func ParseRate(value string) (Rate, error) {
+	limit, window, ok := strings.Cut(value, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("validator: rate %q must be written as <limit>/<window>", value)
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(limit))
+	if err != nil {
+		return Rate{}, fmt.Errorf("validator: invalid limit in rate %q", value)
+	}
+
+	window = strings.TrimSpace(window)
+	duration, ok := rateUnits[window]
+	if !ok {
+		duration, err = time.ParseDuration(window)
+		if err != nil {
+			return Rate{}, fmt.Errorf("validator: invalid window in rate %q", value)
+		}
+	}
+	return Rate{Limit: count, Window: Seconds(duration.Seconds())}, nil
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%v/%v", r.Limit, r.Window.Duration())
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+func (r *Rate) UnmarshalJSON(raw []byte) error {
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return fmt.Errorf("validator: rate must be a string: %s", raw)
+	}
+
+	rate, err := ParseRate(value)
+	if err != nil {
+		return err
+	}
+	*r = rate
+	return nil
+}
+
+// ApplyRate replaces the limit and window of the config and of its additional limits by their rate, when a rate is provided
+// The rate takes priority, so the rate of an existing config can be changed without removing its limit and window
+func (data CreateData) ApplyRate() CreateData {
+	if data.Rate != nil {
+		data.Limit = data.Rate.Limit
+		data.Window = data.Rate.Window
+		data.Rate = nil
+	}
+
+	if len(data.Limits) > 0 {
+		limits := make([]CreateData, len(data.Limits))
+		for i, limit := range data.Limits {
+			limits[i] = limit.ApplyRate()
+		}
+		data.Limits = limits
+	}
+	return data
+}
@@ -0,0 +1,102 @@
+package validator
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSecondsUnmarshal(t *testing.T) {
+	tests := map[string]time.Duration{
+		`60`:      time.Minute,
+		`0.5`:     500 * time.Millisecond,
+		`"500ms"`: 500 * time.Millisecond,
+		`"15m"`:   15 * time.Minute,
+		`"1h"`:    time.Hour,
+	}
+	for raw, expected := range tests {
+		t.Run(raw, func(t *testing.T) {
+			var seconds Seconds
+			if err := json.Unmarshal([]byte(raw), &seconds); err != nil {
+				t.Fatalf("Expect error to be %v, but got %v", nil, err)
+			}
+			if seconds.Duration() != expected {
+				t.Errorf("Expect duration to be %v, but got %v", expected, seconds.Duration())
+			}
+		})
+	}
+
+	t.Run("invalid duration", func(t *testing.T) {
+		for _, raw := range []string{`"15 minutes"`, `true`, `"1"`} {
+			var seconds Seconds
+			if err := json.Unmarshal([]byte(raw), &seconds); err == nil {
+				t.Errorf("Expect %v to be invalid, but got %v", raw, seconds)
+			}
+		}
+	})
+}
+
+func TestParseRate(t *testing.T) {
+	tests := map[string]Rate{
+		"100/min":  {Limit: 100, Window: 60},
+		"5/s":      {Limit: 5, Window: 1},
+		"10/500ms": {Limit: 10, Window: 0.5},
+		"1000/day": {Limit: 1000, Window: 86400},
+		"20 / 15m": {Limit: 20, Window: 900},
+	}
+	for value, expected := range tests {
+		t.Run(value, func(t *testing.T) {
+			rate, err := ParseRate(value)
+			if err != nil || rate != expected {
+				t.Errorf("Expect rate to be %v, but got %v (%v)", expected, rate, err)
+			}
+		})
+	}
+
+	t.Run("invalid rate", func(t *testing.T) {
+		for _, value := range []string{"100", "many/min", "100/fortnight"} {
+			if rate, err := ParseRate(value); err == nil {
+				t.Errorf("Expect %v to be invalid, but got %v", value, rate)
+			}
+		}
+	})
+
+	t.Run("rate is written back in the same format", func(t *testing.T) {
+		rate := Rate{Limit: 100, Window: 60}
+		parsed, err := ParseRate(rate.String())
+		if err != nil || parsed != rate {
+			t.Errorf("Expect rate to be %v, but got %v (%v)", rate, parsed, err)
+		}
+	})
+}
+
+func TestApplyRate(t *testing.T) {
+	var data CreateData
+	json.Unmarshal([]byte(`{"rate": "2/500ms", "limit": 10, "window": 60, "limits": [{"rate": "100/hour"}]}`), &data)
+	data = data.ApplyRate()
+
+	t.Run("rate takes priority over limit and window", func(t *testing.T) {
+		if data.Rate != nil || data.Limit != 2 || data.Window.Duration() != 500*time.Millisecond {
+			t.Errorf("Expect limit to be %v per %v, but got %v per %v", 2, 500*time.Millisecond, data.Limit, data.Window.Duration())
+		}
+		if limit := data.Limits[0]; limit.Limit != 100 || limit.Window.Duration() != time.Hour {
+			t.Errorf("Expect additional limit to be %v per %v, but got %v per %v", 100, time.Hour, limit.Limit, limit.Window.Duration())
+		}
+	})
+
+	t.Run("sub-second window", func(t *testing.T) {
+		currentTime := time.Now()
+		clientData := NewRateLimiterData(data, currentTime)
+		for _, expected := range []bool{true, true, false} {
+			result := checkLimits(clientData, currentTime, 1)
+			clientData = result.Data
+			if result.Status != expected {
+				t.Errorf("Expect validation to be %v, but got %v", expected, result.Status)
+			}
+		}
+
+		if result := checkLimits(clientData, currentTime.Add(501*time.Millisecond), 1); !result.Status {
+			t.Errorf("Expect validation after the window to be %v, but got %v", true, result.Status)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package validator
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"time"
+)
+
+// Number of clients removed by eviction since the process started, published on /debug/vars
+var EvictedClients = expvar.NewInt("rate_limiter_evicted_clients")
+
+// Evicter is implemented by stores that need to remove idle clients themselves
+// Stores that expire the data of a client on their own, such as the Redis store, do not need it
+type Evicter interface {
+	// Evict removes every client that is not configured and whose limits have all been refreshed, and returns the number removed
+	Evict(currentTime time.Time) (int, error)
+}
+
+// Evict removes idle clients created from the default values
+// Such a client is the same as a new client once all of its limits have been refreshed, so removing it does not change any limit
+// Configured clients are never removed, as their config would be lost
+func (s *MemoryStore) Evict(currentTime time.Time) (int, error) {
+	evicted := 0
+	for _, shard := range s.shards {
+		shard.mutex.Lock()
+		for clientID, data := range shard.data {
+			if !data.Configured && IsExpired(data, currentTime) {
+				shard.remove(clientID)
+				evicted++
+			}
+		}
+		shard.mutex.Unlock()
+	}
+	EvictedClients.Add(int64(evicted))
+	return evicted, nil
+}
+
+// RunEviction evicts idle clients from the store every interval until the context is done
+func RunEviction(ctx context.Context, store Evicter, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			evicted, err := store.Evict(time.Now())
+			if err != nil {
+				log.Println("Error evicting idle clients:", err)
+				continue
+			}
+			log.Printf("Evicted %v idle clients\n", evicted)
+		}
+	}
+}
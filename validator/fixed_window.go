@@ -0,0 +1,38 @@
+package validator
+
+import (
+	"time"
+)
+
+const AlgorithmFixedWindow = "fixed_window"
+
+// FixedWindowAlgorithm counts requests in windows aligned to the wall clock, for example every 10 minutes at :00, :10, :20
+// The window boundary is computed when a request is made, so no cron is needed to refresh the limit
+// Requests is used as the count of the current window, and FirstRequestTime as the start of the current window
+type FixedWindowAlgorithm struct{}
+
+func (FixedWindowAlgorithm) Allow(data RateLimiterData, currentTime time.Time, cost int) RateLimitCheckResult {
+	// Windows are aligned to multiples of the window since the zero time, which lines up with the clock in UTC
+	windowStart := currentTime.Truncate(data.Window)
+	if !data.FirstRequestTime.Equal(windowStart) {
+		data.Requests = 0
+		data.FirstRequestTime = windowStart
+	}
+
+	if data.Requests+cost > data.Limit {
+		result := RateLimitCheckResult{
+			Status: false, Data: data, Remaining: max(data.Limit-data.Requests, 0),
+			Reset: counterReset(data, currentTime),
+		}
+		if cost <= data.Limit {
+			result.RetryAfter = windowStart.Add(data.Window).Sub(currentTime)
+		}
+		return result
+	}
+
+	data.Requests += cost
+	return RateLimitCheckResult{
+		Status: true, Data: data, Remaining: data.Limit - data.Requests,
+		Reset: counterReset(data, currentTime),
+	}
+}
@@ -0,0 +1,49 @@
+package validator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFixedWindowAlgorithm(t *testing.T) {
+	t.Run("window is aligned to the clock", func(t *testing.T) {
+		currentTime := time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC)
+		data := RateLimiterData{Policy: Policy{Algorithm: AlgorithmFixedWindow, Limit: 2, Window: 10 * time.Minute}}
+		algorithm := FixedWindowAlgorithm{}
+
+		for i := 0; i < 2; i++ {
+			response := algorithm.Allow(data, currentTime, 1)
+			if !response.Status {
+				t.Fatalf("Expect request %v to be allowed", i+1)
+			}
+			data = response.Data
+		}
+
+		expectedStart := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+		if !data.FirstRequestTime.Equal(expectedStart) {
+			t.Errorf("Expect window to start at %v, but got %v", expectedStart, data.FirstRequestTime)
+		}
+
+		response := algorithm.Allow(data, currentTime, 1)
+		if response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", false, response.Status)
+		}
+
+		if response.RetryAfter != 2*time.Minute+30*time.Second {
+			t.Errorf("Expect retry after to be %v, but got %v", 2*time.Minute+30*time.Second, response.RetryAfter)
+		}
+	})
+
+	t.Run("limit refreshed at the next boundary", func(t *testing.T) {
+		data := RateLimiterData{
+			Policy: Policy{Algorithm: AlgorithmFixedWindow, Limit: 2, Window: 10 * time.Minute},
+			Usage:  Usage{Requests: 2, FirstRequestTime: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)},
+		}
+
+		response := FixedWindowAlgorithm{}.Allow(data, time.Date(2024, 1, 1, 10, 10, 0, 0, time.UTC), 1)
+
+		if !response.Status || response.Data.Requests != 1 {
+			t.Errorf("Expect request to be allowed in a new window, but got %v and %v", response.Status, response.Data.Requests)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+package validator
+
+import (
+	"time"
+)
+
+const AlgorithmGCRA = "gcra"
+
+// GCRAAlgorithm implements the generic cell rate algorithm, which only keeps the theoretical arrival time of the next request
+// Requests are spaced by window / limit, and up to burst requests can arrive earlier than their theoretical arrival time
+// When burst is not configured, the limit is used so the client is able to use the whole limit at once
+type GCRAAlgorithm struct{}
+
+func (GCRAAlgorithm) Allow(data RateLimiterData, currentTime time.Time, cost int) RateLimitCheckResult {
+	emissionInterval := data.Window / time.Duration(data.Limit)
+	burst := data.Burst
+	if burst <= 0 {
+		burst = data.Limit
+	}
+
+	theoreticalArrivalTime := data.TheoreticalArrivalTime
+	if theoreticalArrivalTime.Before(currentTime) {
+		theoreticalArrivalTime = currentTime
+	}
+
+	// The request is allowed if the new arrival time is within the burst tolerance
+	burstOffset := emissionInterval * time.Duration(burst)
+	newArrivalTime := theoreticalArrivalTime.Add(emissionInterval * time.Duration(cost))
+	allowAt := newArrivalTime.Add(-burstOffset)
+	if currentTime.Before(allowAt) {
+		result := RateLimitCheckResult{
+			Status: false, Data: data, Remaining: gcraRemaining(theoreticalArrivalTime, currentTime, emissionInterval, burstOffset),
+			Reset: theoreticalArrivalTime,
+		}
+		// A cost above the burst can not be allowed by waiting
+		if cost <= burst {
+			result.RetryAfter = allowAt.Sub(currentTime)
+		}
+		return result
+	}
+
+	data.TheoreticalArrivalTime = newArrivalTime
+	return RateLimitCheckResult{
+		Status: true, Data: data, Remaining: gcraRemaining(newArrivalTime, currentTime, emissionInterval, burstOffset),
+		Reset: newArrivalTime,
+	}
+}
+
+// gcraRemaining computes how many requests can still be made at the current time
+func gcraRemaining(theoreticalArrivalTime time.Time, currentTime time.Time, emissionInterval time.Duration, burstOffset time.Duration) int {
+	if emissionInterval <= 0 {
+		return 0
+	}
+	return max(int((burstOffset-theoreticalArrivalTime.Sub(currentTime))/emissionInterval), 0)
+}
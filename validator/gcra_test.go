@@ -0,0 +1,59 @@
+package validator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGCRAAlgorithm(t *testing.T) {
+	t.Run("allow burst and compute retry after", func(t *testing.T) {
+		currentTime := time.Now()
+		data := RateLimiterData{Policy: Policy{Algorithm: AlgorithmGCRA, Limit: 10, Window: 10 * time.Second, Burst: 2}}
+		algorithm := GCRAAlgorithm{}
+
+		for i := 0; i < 2; i++ {
+			response := algorithm.Allow(data, currentTime, 1)
+			if !response.Status {
+				t.Fatalf("Expect request %v to be allowed", i+1)
+			}
+			data = response.Data
+		}
+
+		response := algorithm.Allow(data, currentTime.Add(400*time.Millisecond), 1)
+		if response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", false, response.Status)
+		}
+
+		if response.RetryAfter != 600*time.Millisecond {
+			t.Errorf("Expect retry after to be %v, but got %v", 600*time.Millisecond, response.RetryAfter)
+		}
+
+		response = algorithm.Allow(data, currentTime.Add(time.Second), 1)
+		if !response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", true, response.Status)
+		}
+	})
+
+	t.Run("burst defaults to limit", func(t *testing.T) {
+		currentTime := time.Now()
+		data := RateLimiterData{Policy: Policy{Algorithm: AlgorithmGCRA, Limit: 3, Window: 3 * time.Second}}
+		algorithm := GCRAAlgorithm{}
+
+		for i := 0; i < 3; i++ {
+			response := algorithm.Allow(data, currentTime, 1)
+			if !response.Status {
+				t.Fatalf("Expect request %v to be allowed", i+1)
+			}
+			data = response.Data
+		}
+
+		if !data.TheoreticalArrivalTime.Equal(currentTime.Add(3 * time.Second)) {
+			t.Errorf("Expect theoretical arrival time to be %v, but got %v", currentTime.Add(3*time.Second), data.TheoreticalArrivalTime)
+		}
+
+		response := algorithm.Allow(data, currentTime, 1)
+		if response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", false, response.Status)
+		}
+	})
+}
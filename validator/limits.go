@@ -0,0 +1,135 @@
+package validator
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// LimitName returns the name of the limit, which is used to tell the client which limit was reached
+// A name is generated from the limit config when it is not provided
+func (data RateLimiterData) LimitName() string {
+	if data.Name != "" {
+		return data.Name
+	}
+	if data.Algorithm == AlgorithmTokenBucket {
+		return fmt.Sprintf("%v burst, %v per second", data.Capacity, data.RefillPerSecond)
+	}
+	return fmt.Sprintf("%v per %v", data.Limit, data.Window)
+}
+
+// Size returns the number of units of the limit when none of them are used
+// For GCRA this is the burst, as at most burst requests can be made at once even if the limit is higher
+func (data RateLimiterData) Size() int {
+	if data.Algorithm == AlgorithmTokenBucket {
+		return data.Capacity
+	}
+	if sameAlgorithm(data.Algorithm, AlgorithmGCRA) && data.Burst > 0 {
+		return data.Burst
+	}
+	return data.Limit
+}
+
+// CheckLimits checks every limit of the client the same way as a request, without storing anything
+// Used by stores that decide whether a request is allowed themselves, so the result is described the same way
+func CheckLimits(data RateLimiterData, currentTime time.Time, cost int) RateLimitCheckResult {
+	return checkLimits(data, currentTime, cost)
+}
+
+// checkLimits runs the algorithm of the client and of every additional limit of the client
+// The request is only allowed if all limits allow it, and the updated data is only kept in that case
+// so a limited request does not take from any of the limits
+func checkLimits(data RateLimiterData, currentTime time.Time, cost int) RateLimitCheckResult {
+	result := checkLimit(data, currentTime, cost)
+	denied := result
+	limits := make([]RateLimiterData, len(data.Limits))
+	for i, limit := range data.Limits {
+		limitResult := checkLimit(limit, currentTime, cost)
+		limits[i] = limitResult.Data
+		if limitResult.Remaining < result.Remaining {
+			result.Remaining = limitResult.Remaining
+			result.Limit = limitResult.Limit
+			result.LimitReset = limitResult.LimitReset
+		}
+		if limitResult.Reset.After(result.Reset) {
+			result.Reset = limitResult.Reset
+		}
+
+		// Report the limit with the longest wait, as the request is only allowed once every limit allows it
+		if !limitResult.Status && (denied.Status || waitsLonger(limitResult, denied)) {
+			denied = limitResult
+		}
+	}
+
+	if !denied.Status {
+		return RateLimitCheckResult{
+			Status: false, Data: data, RetryAfter: denied.RetryAfter,
+			Remaining: result.Remaining, Limit: result.Limit, LimitName: denied.LimitName, Reset: result.Reset, LimitReset: result.LimitReset,
+		}
+	}
+
+	if len(data.Limits) > 0 {
+		result.Data.Limits = limits
+	}
+	return result
+}
+
+// checkLimit runs the algorithm of a single limit, without checking the additional limits
+func checkLimit(data RateLimiterData, currentTime time.Time, cost int) RateLimitCheckResult {
+	algorithm, ok := GetAlgorithm(data.Algorithm)
+	if !ok {
+		log.Printf("Unknown algorithm %v, using default algorithm\n", data.Algorithm)
+		algorithm, _ = GetAlgorithm("")
+	}
+
+	result := algorithm.Allow(data, currentTime, cost)
+	result.Limit = data.Size()
+	result.LimitReset = result.Reset
+	// The name is only needed when the limit is reached, so it is not generated for every allowed request
+	if !result.Status {
+		result.LimitName = data.LimitName()
+	}
+	return result
+}
+
+// waitsLonger returns true if the first result has to wait longer than the second before the request is allowed
+// A retry after of 0 means the wait is unknown, which is treated as the longest wait
+func waitsLonger(a RateLimitCheckResult, b RateLimitCheckResult) bool {
+	if b.RetryAfter <= 0 {
+		return false
+	}
+	return a.RetryAfter <= 0 || a.RetryAfter > b.RetryAfter
+}
+
+// IsExpired returns true when every limit of the client has been refreshed, which means the client is the same as a new client
+func IsExpired(data RateLimiterData, currentTime time.Time) bool {
+	// A cost of 0 only checks the limits without using them
+	return !checkLimits(data, currentTime, 0).Reset.After(currentTime)
+}
+
+// LimitStatus is what a client has used of one of its limits
+type LimitStatus struct {
+	Name      string
+	Limit     int
+	Used      int
+	Remaining int
+	// Time when every unit used of the limit is available again
+	Reset time.Time
+}
+
+// CheckStatus returns the status of every limit of the client, starting with the main limit, without using any of the limits
+func CheckStatus(data RateLimiterData, currentTime time.Time) []LimitStatus {
+	statuses := []LimitStatus{}
+	for _, limit := range append([]RateLimiterData{data}, data.Limits...) {
+		// A cost of 0 only checks the limit without using it
+		result := checkLimit(limit, currentTime, 0)
+		statuses = append(statuses, LimitStatus{
+			Name:      limit.LimitName(),
+			Limit:     result.Limit,
+			Used:      max(result.Limit-result.Remaining, 0),
+			Remaining: result.Remaining,
+			Reset:     result.Reset,
+		})
+	}
+	return statuses
+}
@@ -0,0 +1,176 @@
+package validator
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCheckLimits(t *testing.T) {
+	currentTime := time.Now()
+	newData := func() RateLimiterData {
+		return NewRateLimiterData(CreateData{
+			Limit: 2, Window: 1,
+			Limits: []CreateData{{Name: "hourly quota", Limit: 3, Window: 3600}},
+		}, currentTime)
+	}
+
+	t.Run("all limits are charged when allowed", func(t *testing.T) {
+		response := checkLimits(newData(), currentTime, 1)
+
+		if !response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", true, response.Status)
+		}
+
+		if response.Data.Requests != 1 || response.Data.Limits[0].Requests != 1 {
+			t.Errorf("Expect every limit to be charged, but got %v and %v", response.Data.Requests, response.Data.Limits[0].Requests)
+		}
+
+		if response.Remaining != 1 {
+			t.Errorf("Expect remaining to be the lowest of all limits %v, but got %v", 1, response.Remaining)
+		}
+
+		if !response.LimitReset.Equal(currentTime.Add(time.Second)) || !response.Reset.Equal(currentTime.Add(time.Hour)) {
+			t.Errorf("Expect reset of the limit to be %v and of every limit to be %v, but got %v and %v",
+				currentTime.Add(time.Second), currentTime.Add(time.Hour), response.LimitReset, response.Reset)
+		}
+	})
+
+	t.Run("limit with the fewest units left is reported", func(t *testing.T) {
+		data := newData()
+		data.Limits[0].Requests = 2
+		response := checkLimits(data, currentTime, 1)
+
+		if response.Remaining != 0 || response.Limit != 3 {
+			t.Errorf("Expect remaining to be %v of %v, but got %v of %v", 0, 3, response.Remaining, response.Limit)
+		}
+	})
+
+	t.Run("no limit is charged when one of them is reached", func(t *testing.T) {
+		data := newData()
+		data.Limits[0].Requests = 3
+
+		response := checkLimits(data, currentTime, 1)
+
+		if response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", false, response.Status)
+		}
+
+		if !reflect.DeepEqual(response.Data, data) {
+			t.Errorf("Expected data to be unchanged %v, but got %v", data, response.Data)
+		}
+
+		if response.LimitName != "hourly quota" {
+			t.Errorf("Expect limit name to be %v, but got %v", "hourly quota", response.LimitName)
+		}
+	})
+
+	t.Run("limit with the longest wait is reported", func(t *testing.T) {
+		data := newData()
+		data.Requests = 2
+		data.Limits[0].Requests = 3
+
+		response := checkLimits(data, currentTime, 1)
+
+		if response.LimitName != "hourly quota" {
+			t.Errorf("Expect limit name to be %v, but got %v", "hourly quota", response.LimitName)
+		}
+
+		if response.RetryAfter <= time.Second {
+			t.Errorf("Expect retry after to be the wait of the hourly quota, but got %v", response.RetryAfter)
+		}
+	})
+
+	t.Run("generated limit name", func(t *testing.T) {
+		response := checkLimits(RateLimiterData{Policy: Policy{Limit: 2, Window: time.Second}, Usage: Usage{Requests: 2, FirstRequestTime: currentTime}}, currentTime, 1)
+
+		if response.LimitName != "2 per 1s" {
+			t.Errorf("Expect limit name to be %v, but got %v", "2 per 1s", response.LimitName)
+		}
+	})
+}
+
+func TestValidateLimitsConfig(t *testing.T) {
+	t.Run("invalid additional limit", func(t *testing.T) {
+		data := CreateData{Limit: 10, Window: 1, Limits: []CreateData{{Limit: 0, Window: 3600}}}
+		response := ValidateConfig(data)
+
+		if response {
+			t.Errorf("Expect validation to be %v, but got %v", false, response)
+		}
+	})
+
+	t.Run("nested additional limits", func(t *testing.T) {
+		data := CreateData{Limit: 10, Window: 1, Limits: []CreateData{
+			{Limit: 1000, Window: 3600, Limits: []CreateData{{Limit: 1, Window: 1}}},
+		}}
+		response := ValidateConfig(data)
+
+		if response {
+			t.Errorf("Expect validation to be %v, but got %v", false, response)
+		}
+	})
+}
+
+func TestIsExpired(t *testing.T) {
+	currentTime := time.Now()
+	data := NewRateLimiterData(CreateData{
+		Limit: 2, Window: 1,
+		Limits: []CreateData{{Algorithm: AlgorithmTokenBucket, Capacity: 10, RefillPerSecond: 0.25}},
+	}, currentTime)
+	data = checkLimits(data, currentTime, 1).Data
+
+	t.Run("not expired while a limit is still used", func(t *testing.T) {
+		// The counter window has passed, but the bucket is not full yet
+		if IsExpired(data, currentTime.Add(2*time.Second)) {
+			t.Errorf("Expect data to not be expired")
+		}
+	})
+
+	t.Run("expired once every limit is refreshed", func(t *testing.T) {
+		if !IsExpired(data, currentTime.Add(4*time.Second)) {
+			t.Errorf("Expect data to be expired")
+		}
+	})
+}
+
+func TestCheckStatus(t *testing.T) {
+	currentTime := time.Now()
+	data := NewRateLimiterData(CreateData{
+		Limit: 5, Window: 10,
+		Limits: []CreateData{{Name: "burst", Algorithm: AlgorithmTokenBucket, Capacity: 4, RefillPerSecond: 1}},
+	}, currentTime)
+	data = checkLimits(data, currentTime, 2).Data
+
+	t.Run("status of every limit", func(t *testing.T) {
+		statuses := CheckStatus(data, currentTime)
+		expected := []LimitStatus{
+			{Name: "5 per 10s", Limit: 5, Used: 2, Remaining: 3, Reset: currentTime.Add(10 * time.Second)},
+			{Name: "burst", Limit: 4, Used: 2, Remaining: 2, Reset: currentTime.Add(2 * time.Second)},
+		}
+
+		if !reflect.DeepEqual(statuses, expected) {
+			t.Errorf("Expect status to be %v, but got %v", expected, statuses)
+		}
+	})
+
+	t.Run("checking the status does not use the limit", func(t *testing.T) {
+		CheckStatus(data, currentTime)
+		statuses := CheckStatus(data, currentTime)
+
+		if statuses[0].Used != 2 || statuses[1].Used != 2 {
+			t.Errorf("Expect used to stay %v, but got %v and %v", 2, statuses[0].Used, statuses[1].Used)
+		}
+	})
+
+	t.Run("size of gcra is the burst", func(t *testing.T) {
+		data := NewRateLimiterData(CreateData{Algorithm: AlgorithmGCRA, Limit: 100, Window: 100, Burst: 5}, currentTime)
+		data = checkLimits(data, currentTime, 2).Data
+		statuses := CheckStatus(data, currentTime)
+		expected := []LimitStatus{{Name: "100 per 1m40s", Limit: 5, Used: 2, Remaining: 3, Reset: currentTime.Add(2 * time.Second)}}
+
+		if !reflect.DeepEqual(statuses, expected) {
+			t.Errorf("Expect status to be %v, but got %v", expected, statuses)
+		}
+	})
+}
@@ -0,0 +1,57 @@
+package validator
+
+import (
+	"rate_limiter/config"
+	"time"
+)
+
+const AlgorithmSlidingLog = "sliding_log"
+
+// SlidingLogAlgorithm keeps the timestamp of every allowed request within the window
+// This guarantees that no more than the limit is allowed in any rolling window, at the cost of memory per request
+type SlidingLogAlgorithm struct{}
+
+func (SlidingLogAlgorithm) Allow(data RateLimiterData, currentTime time.Time, cost int) RateLimitCheckResult {
+	// Only keep requests that are still within the window
+	// A new slice is created so the log stored for the client is never modified in place
+	windowStart := currentTime.Add(-data.Window)
+	requestLog := make([]time.Time, 0, len(data.Log)+cost)
+	for _, requestTime := range data.Log {
+		if requestTime.After(windowStart) {
+			requestLog = append(requestLog, requestTime)
+		}
+	}
+	data.Log = requestLog
+
+	// The log is capped even if the limit is higher, so a single client can not use unbounded memory
+	limit := min(data.Limit, config.MaxSlidingLogSize)
+	if len(data.Log)+cost > limit {
+		result := RateLimitCheckResult{
+			Status: false, Data: data, Remaining: max(limit-len(data.Log), 0),
+			Reset: slidingLogReset(data, currentTime),
+		}
+		// The request is allowed once enough requests have left the window to fit the cost
+		if cost <= limit {
+			expiring := len(data.Log) + cost - limit
+			result.RetryAfter = data.Log[expiring-1].Add(data.Window).Sub(currentTime)
+		}
+		return result
+	}
+
+	// One entry is added per unit of cost, so the log never holds more entries than the limit
+	for i := 0; i < cost; i++ {
+		data.Log = append(data.Log, currentTime)
+	}
+	return RateLimitCheckResult{
+		Status: true, Data: data, Remaining: limit - len(data.Log),
+		Reset: slidingLogReset(data, currentTime),
+	}
+}
+
+// slidingLogReset returns when every request in the log has left the window
+func slidingLogReset(data RateLimiterData, currentTime time.Time) time.Time {
+	if len(data.Log) == 0 {
+		return currentTime
+	}
+	return data.Log[len(data.Log)-1].Add(data.Window)
+}
@@ -0,0 +1,66 @@
+package validator
+
+import (
+	"rate_limiter/config"
+	"testing"
+	"time"
+)
+
+func TestSlidingLogAlgorithm(t *testing.T) {
+	t.Run("no more than limit across window boundary", func(t *testing.T) {
+		currentTime := time.Now()
+		data := RateLimiterData{Policy: Policy{Algorithm: AlgorithmSlidingLog, Limit: 3, Window: 10 * time.Second}}
+		algorithm := SlidingLogAlgorithm{}
+
+		// 3 requests at the end of a window, followed by requests right after the window boundary
+		for i := 0; i < 3; i++ {
+			response := algorithm.Allow(data, currentTime.Add(9*time.Second), 1)
+			if !response.Status {
+				t.Fatalf("Expect request %v to be allowed", i+1)
+			}
+			data = response.Data
+		}
+
+		response := algorithm.Allow(data, currentTime.Add(11*time.Second), 1)
+		if response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", false, response.Status)
+		}
+
+		if response.RetryAfter != 8*time.Second {
+			t.Errorf("Expect retry after to be %v, but got %v", 8*time.Second, response.RetryAfter)
+		}
+
+		response = algorithm.Allow(response.Data, currentTime.Add(19*time.Second+time.Millisecond), 1)
+		if !response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", true, response.Status)
+		}
+
+		if len(response.Data.Log) != 1 {
+			t.Errorf("Expect expired requests to be removed from the log, but got %v", response.Data.Log)
+		}
+	})
+
+	t.Run("stored log is not modified", func(t *testing.T) {
+		currentTime := time.Now()
+		requestLog := make([]time.Time, 1, 10)
+		requestLog[0] = currentTime
+		data := RateLimiterData{Policy: Policy{Algorithm: AlgorithmSlidingLog, Limit: 3, Window: 10 * time.Second}, Usage: Usage{Log: requestLog}}
+
+		SlidingLogAlgorithm{}.Allow(data, currentTime, 1)
+
+		if len(data.Log) != 1 || requestLog[:2][1] != (time.Time{}) {
+			t.Errorf("Expect stored log to be unchanged, but got %v", requestLog[:2])
+		}
+	})
+}
+
+func TestValidateSlidingLogConfig(t *testing.T) {
+	t.Run("limit above the log size", func(t *testing.T) {
+		data := CreateData{Algorithm: AlgorithmSlidingLog, Limit: config.MaxSlidingLogSize + 1, Window: 1}
+		response := ValidateConfig(data)
+
+		if response {
+			t.Errorf("Expect validation to be %v, but got %v", false, response)
+		}
+	})
+}
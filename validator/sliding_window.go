@@ -0,0 +1,81 @@
+package validator
+
+import (
+	"time"
+)
+
+const AlgorithmSlidingWindow = "sliding_window"
+
+// SlidingWindowAlgorithm approximates a rolling window using only the request count of the current and previous window
+// The previous count is weighted by how much of the previous window still overlaps with the rolling window
+// Requests is used as the count of the current window, and FirstRequestTime as the start of the current window
+type SlidingWindowAlgorithm struct{}
+
+func (SlidingWindowAlgorithm) Allow(data RateLimiterData, currentTime time.Time, cost int) RateLimitCheckResult {
+	if data.FirstRequestTime.IsZero() {
+		data.FirstRequestTime = currentTime
+	}
+
+	// Move to the window containing the current time
+	// The previous count is only kept if the previous window is directly before the current one
+	elapsed := currentTime.Sub(data.FirstRequestTime)
+	if elapsed >= data.Window {
+		windows := elapsed / data.Window
+		if windows == 1 {
+			data.PreviousRequests = data.Requests
+		} else {
+			data.PreviousRequests = 0
+		}
+		data.Requests = 0
+		data.FirstRequestTime = data.FirstRequestTime.Add(windows * data.Window)
+		elapsed -= windows * data.Window
+	}
+
+	weight := 1 - float64(elapsed)/float64(data.Window)
+	estimate := float64(data.PreviousRequests)*weight + float64(data.Requests)
+	if estimate+float64(cost) > float64(data.Limit) {
+		return RateLimitCheckResult{
+			Status: false, Data: data, Remaining: max(int(float64(data.Limit)-estimate), 0),
+			RetryAfter: slidingWindowRetryAfter(data, elapsed, cost), Reset: slidingWindowReset(data, currentTime),
+		}
+	}
+
+	data.Requests += cost
+	return RateLimitCheckResult{
+		Status: true, Data: data, Remaining: max(int(float64(data.Limit)-estimate)-cost, 0),
+		Reset: slidingWindowReset(data, currentTime),
+	}
+}
+
+// slidingWindowReset returns when both the current and previous count have left the rolling window
+func slidingWindowReset(data RateLimiterData, currentTime time.Time) time.Time {
+	if data.Requests > 0 {
+		return data.FirstRequestTime.Add(2 * data.Window)
+	}
+	if data.PreviousRequests > 0 {
+		return data.FirstRequestTime.Add(data.Window)
+	}
+	return currentTime
+}
+
+// slidingWindowRetryAfter computes when the weighted count is low enough to allow the cost of the request
+func slidingWindowRetryAfter(data RateLimiterData, elapsed time.Duration, cost int) time.Duration {
+	// A cost above the limit can not be allowed by waiting
+	if cost > data.Limit {
+		return 0
+	}
+
+	// The previous count decreases over the current window, so wait until enough of it has left the rolling window
+	if data.Requests+cost <= data.Limit && data.PreviousRequests > 0 {
+		overlap := float64(data.Limit-cost-data.Requests) / float64(data.PreviousRequests)
+		return time.Duration((1-overlap)*float64(data.Window)) - elapsed
+	}
+
+	// Otherwise wait for the next window, where the current count becomes the previous count
+	untilNextWindow := data.Window - elapsed
+	if data.Requests == 0 {
+		return untilNextWindow
+	}
+	overlap := float64(data.Limit-cost) / float64(data.Requests)
+	return untilNextWindow + time.Duration(max(1-overlap, 0)*float64(data.Window))
+}
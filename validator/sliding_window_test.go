@@ -0,0 +1,61 @@
+package validator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSlidingWindowAlgorithm(t *testing.T) {
+	t.Run("previous window is weighted by overlap", func(t *testing.T) {
+		currentTime := time.Now()
+		data := RateLimiterData{
+			Policy: Policy{Algorithm: AlgorithmSlidingWindow, Limit: 10, Window: 10 * time.Second},
+			Usage:  Usage{Requests: 10, FirstRequestTime: currentTime},
+		}
+		algorithm := SlidingWindowAlgorithm{}
+
+		// At 25% into the next window, 75% of the previous 10 requests are still counted
+		response := algorithm.Allow(data, currentTime.Add(12500*time.Millisecond), 1)
+		for i := 0; i < 2; i++ {
+			if !response.Status {
+				t.Fatalf("Expect request %v to be allowed", i+1)
+			}
+			response = algorithm.Allow(response.Data, currentTime.Add(12500*time.Millisecond), 1)
+		}
+
+		if response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", false, response.Status)
+		}
+
+		// 10 * (1 - x) + 2 + 1 <= 10 once x reaches 30% of the window
+		if response.RetryAfter != 500*time.Millisecond {
+			t.Errorf("Expect retry after to be %v, but got %v", 500*time.Millisecond, response.RetryAfter)
+		}
+
+		if response.Data.PreviousRequests != 10 || response.Data.Requests != 2 {
+			t.Errorf("Expect counts to be %v and %v, but got %v and %v", 10, 2, response.Data.PreviousRequests, response.Data.Requests)
+		}
+
+		if !response.Data.FirstRequestTime.Equal(currentTime.Add(10 * time.Second)) {
+			t.Errorf("Expect window to start at %v, but got %v", currentTime.Add(10*time.Second), response.Data.FirstRequestTime)
+		}
+	})
+
+	t.Run("previous window is dropped after a full window", func(t *testing.T) {
+		currentTime := time.Now()
+		data := RateLimiterData{
+			Policy: Policy{Algorithm: AlgorithmSlidingWindow, Limit: 10, Window: 10 * time.Second},
+			Usage:  Usage{Requests: 10, FirstRequestTime: currentTime},
+		}
+
+		response := SlidingWindowAlgorithm{}.Allow(data, currentTime.Add(25*time.Second), 1)
+
+		if !response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", true, response.Status)
+		}
+
+		if response.Data.PreviousRequests != 0 || response.Data.Requests != 1 {
+			t.Errorf("Expect counts to be %v and %v, but got %v and %v", 0, 1, response.Data.PreviousRequests, response.Data.Requests)
+		}
+	})
+}
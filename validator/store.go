@@ -0,0 +1,304 @@
+package validator
+
+import (
+	"container/list"
+	"errors"
+	"expvar"
+	"rate_limiter/config"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Store owns the data of every client, so the rate limiter and handlers do not depend on how or where the data is kept
+type Store interface {
+	// Get returns the data of the client, and false if the client does not exist
+	Get(clientID string) (RateLimiterData, bool, error)
+	// Update atomically replaces the data of the client with the data returned by update
+	// update receives the current data of the client, and false if the client does not exist
+	// update may be called more than once by stores that retry on conflict, so it should not have other side effects
+	Update(clientID string, update func(data RateLimiterData, ok bool) RateLimiterData) error
+	Delete(clientID string) error
+	// List returns the data of every client
+	List() (map[string]RateLimiterData, error)
+}
+
+// LimitChecker is implemented by stores that are able to check the request limit of some clients themselves
+// CheckRequestLimit returns false when the store does not handle the client, in which case the data is updated through Store.Update
+type LimitChecker interface {
+	CheckRequestLimit(clientID string, currentTime time.Time, cost int) (RateLimitCheckResult, bool, error)
+}
+
+// CommitUpdater is implemented by stores that are able to tell which data an update actually kept
+// commit is called while the client is still locked, with the client the data was kept for, which is OverflowClientID
+// when a new client was counted in the overflow bucket. It is not called for data that was discarded, for example when
+// the client was rejected, so a caller such as the write-ahead log only records changes that were made
+type CommitUpdater interface {
+	UpdateCommit(clientID string, update func(data RateLimiterData, ok bool) RateLimiterData, commit func(clientID string, data RateLimiterData)) error
+}
+
+// MemoryStore keeps the data of every client in memory
+// Clients are split into shards, each guarded by its own mutex, so requests for different clients do not block each other
+type MemoryStore struct {
+	shards []*memoryShard
+	// Maximum number of clients across every shard, 0 means no limit
+	maxClients int64
+	// What to do with a new client when the store is full, one of the MaxClientsPolicy values
+	maxClientsPolicy string
+	// Number of clients across every shard, the overflow bucket is not counted
+	clients atomic.Int64
+}
+
+type memoryShard struct {
+	mutex sync.Mutex
+	data  map[string]RateLimiterData
+	// Number of clients of the store, shared by every shard
+	clients *atomic.Int64
+	// Clients created from the default values, from the most to the least recently used
+	// Configured clients are not part of it, as they are never evicted
+	lru         *list.List
+	lruElements map[string]*list.Element
+}
+
+// Policies when a new client is seen while the store already tracks the maximum number of clients
+const (
+	// Remove the least recently used client created from the default values
+	MaxClientsPolicyEvict = "evict"
+	// Reject the requests of the new client
+	MaxClientsPolicyReject = "reject"
+	// Count the requests of every new client in a single shared overflow bucket
+	MaxClientsPolicyOverflow = "overflow"
+)
+
+// Client ID of the shared overflow bucket, no request can use it as an empty clientID is not valid
+const OverflowClientID = ""
+
+var ErrTooManyClients = errors.New("validator: too many clients")
+
+// Number of requests of new clients rejected or sent to the overflow bucket because the store was full, published on /debug/vars
+var RejectedClients = expvar.NewInt("rate_limiter_rejected_clients")
+var OverflowClients = expvar.NewInt("rate_limiter_overflow_clients")
+
+// NewMemoryStore creates a store containing a copy of the given data, using the number of shards and maximum clients from the config
+func NewMemoryStore(data map[string]RateLimiterData) *MemoryStore {
+	return NewShardedMemoryStore(data, config.StoreShards)
+}
+
+// NewShardedMemoryStore creates a store containing a copy of the given data, split into the given number of shards
+func NewShardedMemoryStore(data map[string]RateLimiterData, shards int) *MemoryStore {
+	return NewBoundedMemoryStore(data, shards, config.MaxClients, config.MaxClientsPolicy)
+}
+
+// NewBoundedMemoryStore creates a store that tracks at most maxClients clients, applying the policy to new clients once it is full
+// Configured clients are always added, so they are the only clients that can go over maxClients
+func NewBoundedMemoryStore(data map[string]RateLimiterData, shards int, maxClients int, policy string) *MemoryStore {
+	store := &MemoryStore{shards: make([]*memoryShard, max(shards, 1)), maxClients: int64(max(maxClients, 0)), maxClientsPolicy: policy}
+	for i := range store.shards {
+		store.shards[i] = &memoryShard{data: map[string]RateLimiterData{}, clients: &store.clients, lru: list.New(), lruElements: map[string]*list.Element{}}
+	}
+	for clientID, clientData := range data {
+		if clientID != OverflowClientID {
+			store.clients.Add(1)
+		}
+		store.shard(clientID).set(clientID, clientData)
+	}
+	return store
+}
+
+func (s *MemoryStore) shard(clientID string) *memoryShard {
+	return s.shards[shardIndex(clientID, len(s.shards))]
+}
+
+// shardIndex hashes the clientID using FNV-1a to pick one of the shards
+func shardIndex(clientID string, shards int) int {
+	hash := uint32(2166136261)
+	for i := 0; i < len(clientID); i++ {
+		hash ^= uint32(clientID[i])
+		hash *= 16777619
+	}
+	return int(hash % uint32(shards))
+}
+
+func (s *MemoryStore) Get(clientID string) (RateLimiterData, bool, error) {
+	shard := s.shard(clientID)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	data, ok := shard.data[clientID]
+	return data, ok, nil
+}
+
+func (s *MemoryStore) Update(clientID string, update func(data RateLimiterData, ok bool) RateLimiterData) error {
+	return s.UpdateCommit(clientID, update, nil)
+}
+
+func (s *MemoryStore) UpdateCommit(clientID string, update func(data RateLimiterData, ok bool) RateLimiterData, commit func(clientID string, data RateLimiterData)) error {
+	shard := s.shard(clientID)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	data, ok := shard.data[clientID]
+	if ok || clientID == OverflowClientID {
+		shard.commit(clientID, update(data, ok), commit)
+		return nil
+	}
+
+	if s.reserve() {
+		shard.commit(clientID, update(data, ok), commit)
+		return nil
+	}
+
+	// The store is full, configured clients are always added as they are created by an operator rather than by a request
+	newData := update(data, ok)
+	admitted := newData.Configured
+	if admitted {
+		s.clients.Add(1)
+	}
+
+	// The slot of an evicted client can be taken by a new client of another shard first, in which case another client is evicted
+	for !admitted && s.evictOldest(shard, s.maxClientsPolicy == MaxClientsPolicyEvict) {
+		admitted = s.reserve()
+	}
+	if admitted {
+		shard.commit(clientID, newData, commit)
+		return nil
+	}
+
+	// The data of the new client is discarded, so commit is not called for it
+	if s.maxClientsPolicy == MaxClientsPolicyOverflow {
+		OverflowClients.Add(1)
+		return s.updateOverflow(shard, update, commit)
+	}
+	RejectedClients.Add(1)
+	return ErrTooManyClients
+}
+
+// updateOverflow applies the update to the shared overflow bucket instead of the new client
+// The shard of the new client is still locked, which is safe as other shards are only locked with TryLock while a shard is held
+func (s *MemoryStore) updateOverflow(locked *memoryShard, update func(data RateLimiterData, ok bool) RateLimiterData, commit func(clientID string, data RateLimiterData)) error {
+	shard := s.shard(OverflowClientID)
+	if shard != locked {
+		shard.mutex.Lock()
+		defer shard.mutex.Unlock()
+	}
+
+	data, ok := shard.data[OverflowClientID]
+	shard.commit(OverflowClientID, update(data, ok), commit)
+	return nil
+}
+
+// reserve counts a new client, and returns false without counting it if the store is full
+func (s *MemoryStore) reserve() bool {
+	if s.maxClients == 0 {
+		s.clients.Add(1)
+		return true
+	}
+
+	for {
+		clients := s.clients.Load()
+		if clients >= s.maxClients {
+			return false
+		}
+		if s.clients.CompareAndSwap(clients, clients+1) {
+			return true
+		}
+	}
+}
+
+// evictOldest removes the least recently used client of the locked shard, or of another shard when it has none
+// Other shards are skipped while they are locked, so two shards never wait on each other. As each shard has its own
+// order, the client removed is the least recently used of its shard rather than of the whole store
+func (s *MemoryStore) evictOldest(locked *memoryShard, force bool) bool {
+	if locked.evictOldest(force) {
+		return true
+	}
+
+	for _, shard := range s.shards {
+		if shard == locked || !shard.mutex.TryLock() {
+			continue
+		}
+		evicted := shard.evictOldest(force)
+		shard.mutex.Unlock()
+		if evicted {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *MemoryStore) Delete(clientID string) error {
+	shard := s.shard(clientID)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	shard.remove(clientID)
+	return nil
+}
+
+// commit keeps the data of the client, and reports it to commit when it is set
+func (shard *memoryShard) commit(clientID string, data RateLimiterData, commit func(clientID string, data RateLimiterData)) {
+	shard.set(clientID, data)
+	if commit != nil {
+		commit(clientID, data)
+	}
+}
+
+// set keeps the data of the client and marks it as the most recently used
+func (shard *memoryShard) set(clientID string, data RateLimiterData) {
+	shard.data[clientID] = data
+	if data.Configured || clientID == OverflowClientID {
+		if element, ok := shard.lruElements[clientID]; ok {
+			shard.lru.Remove(element)
+			delete(shard.lruElements, clientID)
+		}
+		return
+	}
+
+	if element, ok := shard.lruElements[clientID]; ok {
+		shard.lru.MoveToFront(element)
+		return
+	}
+	shard.lruElements[clientID] = shard.lru.PushFront(clientID)
+}
+
+func (shard *memoryShard) remove(clientID string) {
+	if _, ok := shard.data[clientID]; ok && clientID != OverflowClientID {
+		shard.clients.Add(-1)
+	}
+	delete(shard.data, clientID)
+	if element, ok := shard.lruElements[clientID]; ok {
+		shard.lru.Remove(element)
+		delete(shard.lruElements, clientID)
+	}
+}
+
+// evictOldest removes the least recently used client created from the default values, and returns false if no client was removed
+// Unless force is set, the client is only removed if all of its limits are refreshed, so removing it does not change any limit
+func (shard *memoryShard) evictOldest(force bool) bool {
+	element := shard.lru.Back()
+	if element == nil {
+		return false
+	}
+
+	clientID := element.Value.(string)
+	if !force && !IsExpired(shard.data[clientID], time.Now()) {
+		return false
+	}
+	shard.remove(clientID)
+	EvictedClients.Add(1)
+	return true
+}
+
+// List returns the data of every client
+// Shards are locked one at a time, so the result is not a consistent snapshot across shards
+func (s *MemoryStore) List() (map[string]RateLimiterData, error) {
+	data := map[string]RateLimiterData{}
+	for _, shard := range s.shards {
+		shard.mutex.Lock()
+		for clientID, clientData := range shard.data {
+			data[clientID] = clientData
+		}
+		shard.mutex.Unlock()
+	}
+	return data, nil
+}
@@ -0,0 +1,262 @@
+package validator
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"rate_limiter/config"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	t.Run("store keeps a copy of the seed data", func(t *testing.T) {
+		seed := map[string]RateLimiterData{"PT A": {Policy: Policy{Limit: 3, Window: 5 * time.Second}}}
+		store := NewMemoryStore(seed)
+		delete(seed, "PT A")
+
+		_, ok, _ := store.Get("PT A")
+		if !ok {
+			t.Errorf("Expect client to exist in the store")
+		}
+	})
+
+	t.Run("update, list and delete", func(t *testing.T) {
+		store := NewMemoryStore(nil)
+		store.Update("PT A", func(data RateLimiterData, ok bool) RateLimiterData {
+			if ok {
+				t.Errorf("Expect client to not exist before the first update")
+			}
+			return RateLimiterData{Policy: Policy{Limit: 3}}
+		})
+
+		data, err := store.List()
+		if err != nil || len(data) != 1 || data["PT A"].Limit != 3 {
+			t.Errorf("Expect list to contain the updated client, but got %v and %v", data, err)
+		}
+
+		store.Delete("PT A")
+		if _, ok, _ := store.Get("PT A"); ok {
+			t.Errorf("Expect client to be deleted")
+		}
+	})
+
+	t.Run("concurrent updates are atomic", func(t *testing.T) {
+		store := NewMemoryStore(nil)
+		var wg sync.WaitGroup
+		for i := 0; i < 100; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				store.Update("PT A", func(data RateLimiterData, ok bool) RateLimiterData {
+					data.Requests++
+					return data
+				})
+			}()
+		}
+		wg.Wait()
+
+		data, _, _ := store.Get("PT A")
+		if data.Requests != 100 {
+			t.Errorf("Expect %v requests, but got %v", 100, data.Requests)
+		}
+	})
+}
+
+// Compare a single shard, which behaves like one global lock, with the sharded store
+// Run with -cpu 1,2,4,8 to see how throughput scales across cores
+func TestMemoryStoreEvict(t *testing.T) {
+	currentTime := time.Now()
+	store := NewMemoryStore(map[string]RateLimiterData{
+		"PT Idle":       {Policy: Policy{Limit: 3, Window: 5 * time.Second}, Usage: Usage{Requests: 3, FirstRequestTime: currentTime.Add(-time.Minute)}},
+		"PT Active":     {Policy: Policy{Limit: 3, Window: 5 * time.Second}, Usage: Usage{Requests: 1, FirstRequestTime: currentTime}},
+		"PT Configured": {Policy: Policy{Limit: 3, Window: 5 * time.Second, Configured: true}, Usage: Usage{Requests: 3, FirstRequestTime: currentTime.Add(-time.Minute)}},
+	})
+	evictedBefore := EvictedClients.Value()
+
+	evicted, err := store.Evict(currentTime)
+	if err != nil {
+		t.Fatalf("Expect no error, but got %v", err)
+	}
+
+	t.Run("only idle clients without config are evicted", func(t *testing.T) {
+		if evicted != 1 {
+			t.Errorf("Expect evicted clients to be %v, but got %v", 1, evicted)
+		}
+
+		data, _ := store.List()
+		if _, ok := data["PT Idle"]; ok || len(data) != 2 {
+			t.Errorf("Expect only the idle client to be evicted, but got %v", data)
+		}
+	})
+
+	t.Run("evicted clients are counted", func(t *testing.T) {
+		if EvictedClients.Value()-evictedBefore != 1 {
+			t.Errorf("Expect evicted clients metric to increase by %v, but got %v", 1, EvictedClients.Value()-evictedBefore)
+		}
+	})
+}
+
+func TestBoundedMemoryStore(t *testing.T) {
+	currentTime := time.Now()
+	configured := RateLimiterData{Policy: Policy{Limit: 10, Window: time.Minute, Configured: true}, Usage: Usage{FirstRequestTime: currentTime}}
+	request := func(store *MemoryStore, clientID string) (RateLimitCheckResult, error) {
+		return (&RateLimiter{}).ValidateRequestLimit(clientID, currentTime, store)
+	}
+
+	t.Run("least recently used default client is evicted", func(t *testing.T) {
+		store := NewBoundedMemoryStore(map[string]RateLimiterData{"PT Configured": configured}, 1, 3, MaxClientsPolicyEvict)
+		request(store, "PT Old")
+		request(store, "PT Recent")
+		request(store, "PT Old")
+		request(store, "PT New")
+
+		data, _ := store.List()
+		if _, ok := data["PT Recent"]; ok || len(data) != 3 {
+			t.Errorf("Expect the least recently used client to be evicted, but got %v", data)
+		}
+	})
+
+	t.Run("configured clients are never evicted", func(t *testing.T) {
+		store := NewBoundedMemoryStore(map[string]RateLimiterData{"PT Configured": configured}, 1, 1, MaxClientsPolicyEvict)
+
+		if _, err := request(store, "PT New"); err != ErrTooManyClients {
+			t.Errorf("Expect error to be %v, but got %v", ErrTooManyClients, err)
+		}
+
+		// A new config is still accepted when the store is full
+		store.Update("PT Configured 2", func(RateLimiterData, bool) RateLimiterData { return configured })
+		if _, ok, _ := store.Get("PT Configured 2"); !ok {
+			t.Errorf("Expect new configured client to be added")
+		}
+	})
+
+	t.Run("reject policy", func(t *testing.T) {
+		store := NewBoundedMemoryStore(nil, 1, 1, MaxClientsPolicyReject)
+		request(store, "PT First")
+		rejectedBefore := RejectedClients.Value()
+
+		if _, err := request(store, "PT Second"); err != ErrTooManyClients {
+			t.Errorf("Expect error to be %v, but got %v", ErrTooManyClients, err)
+		}
+
+		if RejectedClients.Value()-rejectedBefore != 1 {
+			t.Errorf("Expect rejected clients metric to increase by %v, but got %v", 1, RejectedClients.Value()-rejectedBefore)
+		}
+
+		// Existing clients are still allowed
+		if response, err := request(store, "PT First"); err != nil || !response.Status {
+			t.Errorf("Expect existing client to be allowed, but got %v and %v", response.Status, err)
+		}
+	})
+
+	t.Run("reject policy still evicts expired clients", func(t *testing.T) {
+		store := NewBoundedMemoryStore(nil, 1, 1, MaxClientsPolicyReject)
+		(&RateLimiter{}).ValidateRequestLimit("PT Expired", currentTime.Add(-time.Hour), store)
+
+		if _, err := request(store, "PT New"); err != nil {
+			t.Errorf("Expect no error, but got %v", err)
+		}
+	})
+
+	t.Run("overflow policy shares a single bucket", func(t *testing.T) {
+		store := NewBoundedMemoryStore(nil, 1, 1, MaxClientsPolicyOverflow)
+		request(store, "PT First")
+
+		for i := 0; i < config.DefaultLimit; i++ {
+			if response, err := request(store, fmt.Sprintf("PT Overflow %v", i)); err != nil || !response.Status {
+				t.Errorf("Expect request %v to be allowed, but got %v and %v", i, response.Status, err)
+			}
+		}
+
+		response, err := request(store, "PT Overflow Last")
+		if err != nil || response.Status {
+			t.Errorf("Expect request to be limited by the overflow bucket, but got %v and %v", response.Status, err)
+		}
+
+		data, _ := store.List()
+		if len(data) != 2 || data[OverflowClientID].Requests != config.DefaultLimit {
+			t.Errorf("Expect only the first client and the overflow bucket to be tracked, but got %v", data)
+		}
+	})
+
+	t.Run("limit is shared by every shard", func(t *testing.T) {
+		for _, policy := range []string{MaxClientsPolicyEvict, MaxClientsPolicyReject, MaxClientsPolicyOverflow} {
+			store := NewBoundedMemoryStore(nil, 64, 10, policy)
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					for j := 0; j < 100; j++ {
+						request(store, fmt.Sprintf("PT %v %v", i, j))
+					}
+				}(i)
+			}
+			wg.Wait()
+
+			data, _ := store.List()
+			delete(data, OverflowClientID)
+			if len(data) != 10 {
+				t.Errorf("Expect clients tracked with the %v policy to be %v, but got %v", policy, 10, len(data))
+			}
+		}
+	})
+
+	t.Run("deleted clients free their slot", func(t *testing.T) {
+		store := NewBoundedMemoryStore(nil, 64, 1, MaxClientsPolicyReject)
+		request(store, "PT First")
+		store.Delete("PT First")
+
+		if _, err := request(store, "PT Second"); err != nil {
+			t.Errorf("Expect no error, but got %v", err)
+		}
+	})
+}
+
+func BenchmarkValidateRequestLimit(b *testing.B) {
+	// Logging is benchmarked to a real file, as the logger skips all work when the output is discarded
+	logFile, err := os.Create(filepath.Join(b.TempDir(), "app.log"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer logFile.Close()
+	defer log.SetOutput(io.Discard)
+
+	for _, logRequests := range []bool{false, true} {
+		for _, shards := range []int{1, 64} {
+			b.Run(fmt.Sprintf("%v shards, log requests %v", shards, logRequests), func(b *testing.B) {
+				config.LogRequests = logRequests
+				defer func() { config.LogRequests = false }()
+				log.SetOutput(logFile)
+
+				store := NewShardedMemoryStore(nil, shards)
+				rateLimiter := RateLimiter{}
+				var clients atomic.Int64
+				currentTime := time.Now()
+
+				b.RunParallel(func(pb *testing.PB) {
+					// Each goroutine uses its own clients so they only contend on the shard locks
+					// The limit is high enough that every request is allowed
+					clientIDs := make([]string, 16)
+					for i := range clientIDs {
+						clientIDs[i] = fmt.Sprintf("PT %v", clients.Add(1))
+						store.Update(clientIDs[i], func(RateLimiterData, bool) RateLimiterData {
+							return RateLimiterData{Policy: Policy{Limit: math.MaxInt, Window: time.Hour}, Usage: Usage{FirstRequestTime: currentTime}}
+						})
+					}
+					i := 0
+					for pb.Next() {
+						rateLimiter.ValidateRequestLimit(clientIDs[i%len(clientIDs)], currentTime, store)
+						i++
+					}
+				})
+			})
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package validator
+
+import (
+	"math"
+	"time"
+)
+
+const AlgorithmTokenBucket = "token_bucket"
+
+// TokenBucketAlgorithm allows bursts up to the capacity of the bucket, while the sustained rate is limited by the refill rate
+// Each request takes tokens from the bucket based on its cost, and tokens are added back continuously based on the time elapsed
+type TokenBucketAlgorithm struct{}
+
+func (TokenBucketAlgorithm) Allow(data RateLimiterData, currentTime time.Time, cost int) RateLimitCheckResult {
+	// A new bucket starts full so the client is able to burst right away
+	if data.LastRefillTime.IsZero() {
+		data.Tokens = float64(data.Capacity)
+		data.LastRefillTime = currentTime
+	}
+
+	if elapsed := currentTime.Sub(data.LastRefillTime); elapsed > 0 {
+		data.Tokens = math.Min(float64(data.Capacity), data.Tokens+elapsed.Seconds()*data.RefillPerSecond)
+		data.LastRefillTime = currentTime
+	}
+
+	if data.Tokens < float64(cost) {
+		result := RateLimitCheckResult{Status: false, Data: data, Remaining: int(data.Tokens), Reset: tokenBucketReset(data)}
+		// The bucket never holds more than its capacity, so a cost above it can not be allowed by waiting
+		if cost <= data.Capacity {
+			result.RetryAfter = time.Duration(math.Ceil((float64(cost) - data.Tokens) / data.RefillPerSecond * float64(time.Second)))
+		}
+		return result
+	}
+
+	data.Tokens -= float64(cost)
+	return RateLimitCheckResult{Status: true, Data: data, Remaining: int(data.Tokens), Reset: tokenBucketReset(data)}
+}
+
+// tokenBucketReset returns when the bucket is full again
+func tokenBucketReset(data RateLimiterData) time.Time {
+	missing := float64(data.Capacity) - data.Tokens
+	return data.LastRefillTime.Add(time.Duration(math.Ceil(missing / data.RefillPerSecond * float64(time.Second))))
+}
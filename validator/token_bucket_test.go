@@ -0,0 +1,88 @@
+package validator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketAlgorithm(t *testing.T) {
+	t.Run("allow burst up to capacity", func(t *testing.T) {
+		currentTime := time.Now()
+		data := RateLimiterData{Policy: Policy{Algorithm: AlgorithmTokenBucket, Capacity: 20, RefillPerSecond: 2}}
+		algorithm := TokenBucketAlgorithm{}
+
+		for i := 0; i < 20; i++ {
+			response := algorithm.Allow(data, currentTime, 1)
+			if !response.Status {
+				t.Fatalf("Expect request %v to be allowed", i+1)
+			}
+			data = response.Data
+		}
+
+		response := algorithm.Allow(data, currentTime, 1)
+		if response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", false, response.Status)
+		}
+	})
+
+	t.Run("refill based on elapsed time", func(t *testing.T) {
+		currentTime := time.Now()
+		data := RateLimiterData{
+			Policy: Policy{Algorithm: AlgorithmTokenBucket, Capacity: 20, RefillPerSecond: 2},
+			Usage:  Usage{Tokens: 0, LastRefillTime: currentTime},
+		}
+		algorithm := TokenBucketAlgorithm{}
+
+		response := algorithm.Allow(data, currentTime.Add(250*time.Millisecond), 1)
+		if response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", false, response.Status)
+		}
+
+		if response.RetryAfter != 250*time.Millisecond {
+			t.Errorf("Expect retry after to be %v, but got %v", 250*time.Millisecond, response.RetryAfter)
+		}
+
+		response = algorithm.Allow(response.Data, currentTime.Add(time.Second), 1)
+		if !response.Status {
+			t.Errorf("Expect validation to be %v, but got %v", true, response.Status)
+		}
+
+		if response.Data.Tokens != 1 {
+			t.Errorf("Expect %v token left, but got %v", 1, response.Data.Tokens)
+		}
+	})
+
+	t.Run("refill does not exceed capacity", func(t *testing.T) {
+		currentTime := time.Now()
+		data := RateLimiterData{
+			Policy: Policy{Algorithm: AlgorithmTokenBucket, Capacity: 5, RefillPerSecond: 2},
+			Usage:  Usage{Tokens: 0, LastRefillTime: currentTime},
+		}
+
+		response := TokenBucketAlgorithm{}.Allow(data, currentTime.Add(time.Hour), 1)
+
+		if response.Data.Tokens != 4 {
+			t.Errorf("Expect %v tokens left, but got %v", 4, response.Data.Tokens)
+		}
+	})
+}
+
+func TestValidateTokenBucketConfig(t *testing.T) {
+	t.Run("missing refill rate", func(t *testing.T) {
+		config := CreateData{Algorithm: AlgorithmTokenBucket, Capacity: 20}
+		response := ValidateConfig(config)
+
+		if response {
+			t.Errorf("Expect validation to be %v, but got %v", false, response)
+		}
+	})
+
+	t.Run("capacity and refill rate provided", func(t *testing.T) {
+		config := CreateData{Algorithm: AlgorithmTokenBucket, Capacity: 20, RefillPerSecond: 2}
+		response := ValidateConfig(config)
+
+		if !response {
+			t.Errorf("Expect validation to be %v, but got %v", true, response)
+		}
+	})
+}
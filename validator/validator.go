@@ -1,100 +1,434 @@
 package validator
 
 import (
+	"fmt"
 	"log"
+	"maps"
 	"rate_limiter/config"
 	"sync"
 	"time"
 )
 
+// RateLimiterData is the data of a client, made of the policy set by its config and the usage counted from its requests
+// Both are embedded, so their fields can be used directly, for example data.Limit and data.Requests
 type RateLimiterData struct {
+	Policy
+	Usage
+	// Additional limits that must also allow the request, each with their own policy and usage
+	Limits []RateLimiterData
+}
+
+// Policy is how the requests of a client are limited, it only changes when the config of the client changes
+type Policy struct {
+	Limit     int
+	Window    time.Duration
+	Algorithm string
+
+	// Used by the token bucket algorithm
+	Capacity        int
+	RefillPerSecond float64
+
+	// Used by the GCRA algorithm
+	Burst int
+
+	// Limited requests are delayed until they are allowed, unless the wait exceeds this duration
+	MaxWait time.Duration
+	// Maximum number of requests the client can have in flight at once, 0 means no limit
+	MaxInFlight int
+
+	// Name of the limit shown to the client when it is reached, generated from the limit when empty
+	Name string
+
+	// True when the data was created from a config, rather than from the default values for a new client
+	Configured bool
+	// Time the config was last changed, zero for clients created from the default values
+	UpdatedAt time.Time
+	// Free form information about the client provided with the config, not used by the rate limiter
+	Metadata map[string]string
+}
+
+// Usage is what the client has used of its limit, it changes with every request
+type Usage struct {
 	Requests         int
-	Limit            int
-	Window           time.Duration
 	FirstRequestTime time.Time
+
+	// Used by the token bucket algorithm
+	Tokens         float64
+	LastRefillTime time.Time
+
+	// Used by the sliding log algorithm, contains the time of each allowed request within the window
+	Log []time.Time
+
+	// Used by the sliding window algorithm, contains the request count of the previous window
+	PreviousRequests int
+
+	// Used by the GCRA algorithm
+	TheoreticalArrivalTime time.Time
 }
 
 type CreateData struct {
-	Limit  int
-	Window int
+	Limit           int     `json:"limit"`
+	Window          Seconds `json:"window"`
+	Algorithm       string  `json:"algorithm"`
+	Capacity        int     `json:"capacity"`
+	RefillPerSecond float64 `json:"refill_per_second"`
+	Burst           int     `json:"burst"`
+	MaxWait         Seconds `json:"max_wait"`
+	MaxInFlight     int     `json:"max_in_flight"`
+
+	// Limit and window written as a single string, for example "100/min", see ApplyRate
+	Rate *Rate `json:"rate,omitempty"`
+
+	Name     string            `json:"name"`
+	Limits   []CreateData      `json:"limits"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Start the client with a new limit instead of keeping what it has already used
+	ResetUsage bool `json:"reset_usage,omitempty"`
 }
 
 type RateLimiter struct {
-	RateLimiterData
-	Mutex sync.Mutex
+	// Number of requests currently in flight per client, split into shards so different clients do not block each other
+	inFlight [inFlightShards]inFlightShard
+}
+
+const inFlightShards = 64
+
+type inFlightShard struct {
+	mutex  sync.Mutex
+	counts map[string]int
 }
 
 type RateLimitCheckResult struct {
 	Status bool
 	Data   RateLimiterData
+	// Time to wait before the request can be allowed, only set when the algorithm is able to compute it
+	RetryAfter time.Duration
+	// Units left for the client after the request
+	Remaining int
+	// Size of the limit with the fewest units left, the same limit as Remaining
+	Limit int
+	// Name of the limit that was reached, only set when the request is not allowed
+	LimitName string
+	// Time when every unit used by the client is available again
+	Reset time.Time
+	// Time when every unit used of the limit with the fewest units left is available again, the same limit as Remaining
+	LimitReset time.Time
 }
 
 func ValidateClientID(clientID string) bool {
 	return clientID != ""
 }
 
-func (rl *RateLimiter) ValidateRequestLimit(clientID string, currentTime time.Time, data map[string]RateLimiterData) RateLimitCheckResult {
-	rl.Mutex.Lock()
-	defer rl.Mutex.Unlock()
+func ValidateCost(cost int) bool {
+	return cost > 0
+}
 
-	// Use config or default value depending if client data exist
-	// For future improvement, use database/Redis for data storage
-	requests := config.DefaultRequest
-	limit := config.DefaultLimit
-	window := config.DefaultWindow
+func (rl *RateLimiter) ValidateRequestLimit(clientID string, currentTime time.Time, store Store) (RateLimitCheckResult, error) {
+	return rl.ValidateRequestLimitN(clientID, currentTime, 1, store)
+}
 
-	clientData, ok := data[clientID]
-	if ok {
-		log.Printf("Starting Request: %v / %v", clientData.Requests, clientData.Limit)
-		log.Printf("currentTime: %v\n", currentTime)
-		log.Printf("firstRequestTime: %v\n", clientData.FirstRequestTime)
-		log.Printf("difference: %v\n", currentTime.Sub(clientData.FirstRequestTime))
-		log.Printf("window: %v\n", clientData.Window)
-
-		// If first request has already exceeded the time window, refresh the request to 0
-		if currentTime.Sub(clientData.FirstRequestTime) > clientData.Window {
-			clientData.Requests = 0
-			clientData.FirstRequestTime = currentTime
-			data[clientID] = clientData
-			log.Println("Refreshing the rate limit")
+// ValidateRequestLimitN is the same as ValidateRequestLimit, but the request takes cost units from the limit instead of 1
+func (rl *RateLimiter) ValidateRequestLimitN(clientID string, currentTime time.Time, cost int, store Store) (RateLimitCheckResult, error) {
+	// Let the store check the limit itself when it is able to, for example in a single atomic script
+	if checker, ok := store.(LimitChecker); ok {
+		result, handled, err := checker.CheckRequestLimit(clientID, currentTime, cost)
+		if err != nil || handled {
+			return result, err
 		}
+	}
 
-		requests = clientData.Requests
-		limit = clientData.Limit
-	} else {
-		// Create new config so we can keep track of future requests
-		data[clientID] = RateLimiterData{requests, limit, window, currentTime}
+	var result RateLimitCheckResult
+	var startingData RateLimiterData
+	err := store.Update(clientID, func(clientData RateLimiterData, ok bool) RateLimiterData {
+		// Use config or default value depending if client data exist
+		if !ok {
+			// Create new config so we can keep track of future requests
+			clientData = NewDefaultRateLimiterData(currentTime)
+		}
 
-		log.Printf("Starting Request: %v / %v", data[clientID].Requests, data[clientID].Limit)
+		// Nothing is logged here, as the store may hold a lock while the update runs
+		startingData = clientData
+		result = checkLimits(clientData, currentTime, cost)
+		return result.Data
+	})
+	if err != nil {
+		return result, err
+	}
+
+	if !result.Status {
+		log.Printf("Limit %v reached for %v\n", result.LimitName, clientID)
+	}
+	// Every log call takes the lock of the logger, so logging every request would serialize all requests
+	if config.LogRequests {
+		log.Printf("Starting Request: %v / %v, cost: %v", startingData.Requests, startingData.Limit, cost)
 		log.Printf("currentTime: %v\n", currentTime)
-		log.Printf("firstRequestTime: %v\n", data[clientID].FirstRequestTime)
-		log.Printf("difference: %v\n", currentTime.Sub(data[clientID].FirstRequestTime))
-		log.Printf("window: %v\n", data[clientID].Window)
+		log.Printf("firstRequestTime: %v\n", startingData.FirstRequestTime)
+		log.Printf("difference: %v\n", currentTime.Sub(startingData.FirstRequestTime))
+		log.Printf("window: %v\n", startingData.Window)
+		log.Printf("Ending Request: %v / %v", result.Data.Requests, result.Data.Limit)
+	}
+	return result, nil
+}
+
+// Status returns the status of every limit of the client without using any of them, so it can be checked as often as needed
+// A client without data is shown with the default values, but is not added to the store
+func (rl *RateLimiter) Status(clientID string, currentTime time.Time, store Store) ([]LimitStatus, error) {
+	clientData, ok, err := store.Get(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		clientData = NewDefaultRateLimiterData(currentTime)
+	}
+	return CheckStatus(clientData, currentTime), nil
+}
+
+// Peek checks the limits of the client without using any of them
+// Used to describe the limits of the client when a request is limited before its limits are checked
+func (rl *RateLimiter) Peek(clientID string, currentTime time.Time, store Store) (RateLimitCheckResult, error) {
+	clientData, ok, err := store.Get(clientID)
+	if err != nil {
+		return RateLimitCheckResult{}, err
+	}
+	if !ok {
+		clientData = NewDefaultRateLimiterData(currentTime)
+	}
+	// A cost of 0 only checks the limits without using them
+	return checkLimits(clientData, currentTime, 0), nil
+}
+
+// AcquireInFlight reserves an in-flight slot for the client, based on the max in flight of the client config
+// Returns false if the client already has the maximum number of requests in flight
+// Every successful call must be followed by ReleaseInFlight once the request is done
+func (rl *RateLimiter) AcquireInFlight(clientID string, store Store) (bool, error) {
+	maxInFlight := config.DefaultMaxInFlight
+	clientData, ok, err := store.Get(clientID)
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		maxInFlight = clientData.MaxInFlight
+	}
+
+	shard := &rl.inFlight[shardIndex(clientID, inFlightShards)]
+	shard.mutex.Lock()
+	if shard.counts == nil {
+		shard.counts = map[string]int{}
 	}
+	inFlight := shard.counts[clientID]
+	if maxInFlight <= 0 || inFlight < maxInFlight {
+		shard.counts[clientID]++
+	}
+	shard.mutex.Unlock()
+
+	// Logged once the shard is unlocked, so the lock of the logger is not taken while holding the shard
+	if maxInFlight > 0 && inFlight >= maxInFlight {
+		log.Printf("Max in flight reached for %v: %v / %v\n", clientID, inFlight, maxInFlight)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (rl *RateLimiter) ReleaseInFlight(clientID string) {
+	shard := &rl.inFlight[shardIndex(clientID, inFlightShards)]
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
 
-	// Check to see if client has reached the limit
-	if requests >= limit {
-		log.Println("Limit reached, process will not continue")
-		return RateLimitCheckResult{
-			false, data[clientID],
+	shard.counts[clientID]--
+	// Remove the client once nothing is in flight so the map does not grow with every client
+	if shard.counts[clientID] <= 0 {
+		delete(shard.counts, clientID)
+	}
+}
+
+// NewRateLimiterData creates the data of a client from the config, with the usage starting from the current time
+func NewRateLimiterData(data CreateData, currentTime time.Time) RateLimiterData {
+	clientData := RateLimiterData{
+		Policy: NewPolicy(data, currentTime),
+		Usage:  Usage{Requests: 0, FirstRequestTime: currentTime},
+	}
+	for _, limit := range data.Limits {
+		clientData.Limits = append(clientData.Limits, NewRateLimiterData(limit, currentTime))
+	}
+	return clientData
+}
+
+// NewDefaultRateLimiterData creates the data of a new client that has no config, using the default values
+func NewDefaultRateLimiterData(currentTime time.Time) RateLimiterData {
+	return RateLimiterData{
+		Policy: Policy{Limit: config.DefaultLimit, Window: config.DefaultWindow, MaxInFlight: config.DefaultMaxInFlight},
+		Usage:  Usage{Requests: config.DefaultRequest, FirstRequestTime: currentTime},
+	}
+}
+
+// RevertToDefault removes the config of a client, so the default values are used again
+// The usage is kept when the default algorithm is the same as the algorithm of the client, the same as UpdateRateLimiterData
+func RevertToDefault(current RateLimiterData, currentTime time.Time) RateLimiterData {
+	clientData := NewDefaultRateLimiterData(currentTime)
+	if sameAlgorithm(current.Algorithm, clientData.Algorithm) {
+		clientData.Usage = current.Usage
+	}
+	return clientData
+}
+
+// Config returns the config the data was created from, which is the opposite of NewRateLimiterData
+// The metadata and additional limits are copied, so changing the config does not change the data
+func (data RateLimiterData) Config() CreateData {
+	createData := CreateData{
+		Limit:           data.Limit,
+		Window:          Seconds(data.Window.Seconds()),
+		Algorithm:       data.Algorithm,
+		Capacity:        data.Capacity,
+		RefillPerSecond: data.RefillPerSecond,
+		Burst:           data.Burst,
+		MaxWait:         Seconds(data.MaxWait.Seconds()),
+		MaxInFlight:     data.MaxInFlight,
+		Name:            data.Name,
+		Metadata:        maps.Clone(data.Metadata),
+	}
+	for _, limit := range data.Limits {
+		createData.Limits = append(createData.Limits, limit.Config())
+	}
+	return createData
+}
+
+// UpdateRateLimiterData applies a new config to the data of an existing client, keeping what the client has already used
+// The usage is only kept for limits using the same algorithm, as the usage of one algorithm has no meaning for another
+// Additional limits are matched by their position in the config
+func UpdateRateLimiterData(current RateLimiterData, data CreateData, currentTime time.Time) RateLimiterData {
+	clientData := NewRateLimiterData(data, currentTime)
+	if sameAlgorithm(current.Algorithm, clientData.Algorithm) {
+		clientData.Usage = current.Usage
+	}
+	for i := range clientData.Limits {
+		if i < len(current.Limits) && sameAlgorithm(current.Limits[i].Algorithm, clientData.Limits[i].Algorithm) {
+			clientData.Limits[i].Usage = current.Limits[i].Usage
 		}
 	}
+	return clientData
+}
+
+// sameAlgorithm compares two algorithms, where an empty algorithm is the default algorithm
+func sameAlgorithm(a string, b string) bool {
+	if a == "" {
+		a = config.DefaultAlgorithm
+	}
+	if b == "" {
+		b = config.DefaultAlgorithm
+	}
+	return a == b
+}
 
-	// Add to the request count
-	if clientData, ok := data[clientID]; ok {
-		clientData.Requests++
-		data[clientID] = clientData
+// NewPolicy creates the policy of a config, without the policy of its additional limits
+func NewPolicy(data CreateData, currentTime time.Time) Policy {
+	return Policy{
+		Limit:           data.Limit,
+		Window:          data.Window.Duration(),
+		Algorithm:       data.Algorithm,
+		Capacity:        data.Capacity,
+		RefillPerSecond: data.RefillPerSecond,
+		Burst:           data.Burst,
+		MaxWait:         data.MaxWait.Duration(),
+		MaxInFlight:     data.MaxInFlight,
+		Name:            data.Name,
+		Configured:      true,
+		UpdatedAt:       currentTime,
+		Metadata:        data.Metadata,
 	}
-	log.Printf("Ending Request: %v / %v", data[clientID].Requests, data[clientID].Limit)
+}
+
+func ValidateConfig(data CreateData) bool {
+	return len(ConfigErrors(data)) == 0
+}
+
+// ConfigErrors returns an error for every invalid field of the config, or nothing when the config is valid
+func ConfigErrors(data CreateData) []FieldError {
+	return configErrors(data, "")
+}
 
-	return RateLimitCheckResult{
-		true, data[clientID],
+// configErrors validates the config, prefixing every field with the path of the config, for example "limits[0]."
+func configErrors(data CreateData, path string) []FieldError {
+	errs := policyErrors(data, path)
+
+	// Additional limits are validated the same way, but can not contain further limits
+	// Fields that only apply to the whole client are rejected rather than silently ignored
+	for i, limit := range data.Limits {
+		limitPath := fmt.Sprintf("%vlimits[%v].", path, i)
+		if len(limit.Limits) > 0 {
+			errs = append(errs, FieldError{Field: limitPath + "limits", Reason: ReasonInvalidValue, Message: "additional limits can not contain further limits"})
+		}
+		clientFields := []struct {
+			name string
+			set  bool
+		}{
+			{"max_wait", limit.MaxWait != 0},
+			{"max_in_flight", limit.MaxInFlight != 0},
+			{"metadata", len(limit.Metadata) > 0},
+			{"reset_usage", limit.ResetUsage},
+		}
+		for _, field := range clientFields {
+			if field.set {
+				errs = append(errs, FieldError{Field: limitPath + field.name, Reason: ReasonInvalidValue, Message: "is only supported for the whole client, not in additional limits"})
+			}
+		}
+		errs = append(errs, configErrors(limit, limitPath)...)
 	}
+	return errs
 }
 
-func ValidateConfig(config CreateData) bool {
-	if config.Limit <= 0 || config.Window <= 0 {
-		return false
+// policyErrors validates the config without its additional limits
+func policyErrors(data CreateData, path string) []FieldError {
+	errs := []FieldError{}
+	addError := func(field string, reason string, message string) {
+		errs = append(errs, FieldError{Field: path + field, Reason: reason, Message: message})
+	}
+
+	if !ValidateAlgorithm(data.Algorithm) {
+		addError("algorithm", ReasonInvalidValue, fmt.Sprintf("unknown algorithm %v", data.Algorithm))
+	}
+	if data.MaxWait < 0 {
+		addError("max_wait", ReasonOutOfRange, "must not be negative")
+	}
+	if data.MaxInFlight < 0 {
+		addError("max_in_flight", ReasonOutOfRange, "must not be negative")
+	}
+
+	// Token bucket is configured using the capacity and refill rate instead of limit and window
+	if data.Algorithm == AlgorithmTokenBucket {
+		if data.Capacity <= 0 {
+			addError("capacity", ReasonOutOfRange, "must be greater than 0")
+		}
+		if data.RefillPerSecond <= 0 {
+			addError("refill_per_second", ReasonOutOfRange, "must be greater than 0")
+		}
+		return errs
+	}
+
+	// Sliding log keeps one entry per request, so the limit is capped to bound the memory per client
+	if data.Algorithm == AlgorithmSlidingLog && data.Limit > config.MaxSlidingLogSize {
+		addError("limit", ReasonOutOfRange, fmt.Sprintf("must be at most %v for the %v algorithm", config.MaxSlidingLogSize, AlgorithmSlidingLog))
+	}
+
+	if data.Limit <= 0 {
+		addError("limit", ReasonOutOfRange, "must be greater than 0")
+	}
+	// The window is checked after rounding, and stores such as Redis keep the window in milliseconds
+	if data.Window.Duration() < time.Millisecond {
+		addError("window", ReasonOutOfRange, "must be at least 1ms")
+	}
+	// GCRA spaces requests by window / limit, which would be 0 and allow every request if the limit has more requests than nanoseconds in the window
+	if sameAlgorithm(data.Algorithm, AlgorithmGCRA) && data.Window.Duration() >= time.Millisecond && int64(data.Limit) > int64(data.Window.Duration()) {
+		addError("limit", ReasonOutOfRange, fmt.Sprintf("must be at most the number of nanoseconds in the window (%v) for the %v algorithm", int64(data.Window.Duration()), AlgorithmGCRA))
 	}
-	return true
+	if data.Burst < 0 {
+		addError("burst", ReasonOutOfRange, "must not be negative")
+	}
+	return errs
+}
+
+// Empty algorithm is allowed, in which case the default algorithm will be used
+func ValidateAlgorithm(name string) bool {
+	_, ok := GetAlgorithm(name)
+	return ok
 }
@@ -5,7 +5,7 @@ import (
 	"io"
 	"log"
 	"rate_limiter/config"
-	"sync"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -42,7 +42,7 @@ func TestValidateCreateDataFail(t *testing.T) {
 	// log.SetOutput(io.Discard)
 	t.Run("both properties are 0", func(t *testing.T) {
 		expectedStatus := false
-		config := CreateData{0, 0}
+		config := CreateData{Limit: 0, Window: 0}
 		response := ValidateConfig(config)
 
 		if response {
@@ -52,7 +52,7 @@ func TestValidateCreateDataFail(t *testing.T) {
 
 	t.Run("one property is 0", func(t *testing.T) {
 		expectedStatus := false
-		config := CreateData{1, 0}
+		config := CreateData{Limit: 1, Window: 0}
 		response := ValidateConfig(config)
 
 		if response {
@@ -64,7 +64,7 @@ func TestValidateCreateDataFail(t *testing.T) {
 func TestValidateCreateDataSuccess(t *testing.T) {
 	t.Run("[SUCCESS] both properties are greater than 0", func(t *testing.T) {
 		expectedStatus := true
-		config := CreateData{2, 5}
+		config := CreateData{Limit: 2, Window: 5}
 		response := ValidateConfig(config)
 
 		if !response {
@@ -74,8 +74,8 @@ func TestValidateCreateDataSuccess(t *testing.T) {
 }
 
 var mockedRateLimiterData = map[string]RateLimiterData{
-	"PT A":         {Requests: 2, Limit: 3, Window: 5 * time.Second, FirstRequestTime: time.Now()},
-	"PT Limit Max": {Requests: 3, Limit: 3, Window: 3 * time.Second, FirstRequestTime: time.Now()},
+	"PT A":         {Policy: Policy{Limit: 3, Window: 5 * time.Second}, Usage: Usage{Requests: 2, FirstRequestTime: time.Now()}},
+	"PT Limit Max": {Policy: Policy{Limit: 3, Window: 3 * time.Second}, Usage: Usage{Requests: 3, FirstRequestTime: time.Now()}},
 }
 
 func TestValidateRequestLimitFail(t *testing.T) {
@@ -84,27 +84,20 @@ func TestValidateRequestLimitFail(t *testing.T) {
 		clientId := "PT Limit Max"
 		expectedStatus := false
 		expectedData := mockedRateLimiterData[clientId]
-		RateLimiterData := RateLimiterData{
-			Requests:         config.DefaultRequest,
-			Limit:            config.DefaultLimit,
-			Window:           config.DefaultWindow,
-			FirstRequestTime: currentTime,
-		}
+		rateLimiter := RateLimiter{}
 
-		rateLimiter := RateLimiter{
-			RateLimiterData: RateLimiterData,
-			Mutex:           sync.Mutex{},
+		response, err := rateLimiter.ValidateRequestLimit(clientId, currentTime, NewMemoryStore(mockedRateLimiterData))
+		if err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
 		}
 
-		response := rateLimiter.ValidateRequestLimit(clientId, currentTime, mockedRateLimiterData)
-
-		fmt.Println(response.Data == mockedRateLimiterData[clientId])
+		fmt.Println(reflect.DeepEqual(response.Data, mockedRateLimiterData[clientId]))
 
 		if response.Status {
 			t.Errorf("Expect validation to be %v, but got %v", expectedStatus, response.Status)
 		}
 
-		if response.Data != expectedData {
+		if !reflect.DeepEqual(response.Data, expectedData) {
 			t.Errorf("Expected data to be unchanged %v, but got %v", expectedData, response.Data)
 		}
 	})
@@ -117,27 +110,22 @@ func TestValidateRequestLimitSuccess(t *testing.T) {
 		expectedStatus := true
 		expectedData := map[string]RateLimiterData{
 			clientId: {
-				Requests: config.DefaultRequest + 1, Limit: config.DefaultLimit,
-				Window: config.DefaultWindow, FirstRequestTime: currentTime},
-		}
-		RateLimiterData := RateLimiterData{
-			Requests:         config.DefaultRequest,
-			Limit:            config.DefaultLimit,
-			Window:           config.DefaultWindow,
-			FirstRequestTime: currentTime,
-		}
-		rateLimiter := RateLimiter{
-			RateLimiterData: RateLimiterData,
-			Mutex:           sync.Mutex{},
+				Policy: Policy{Limit: config.DefaultLimit, Window: config.DefaultWindow},
+				Usage:  Usage{Requests: config.DefaultRequest + 1, FirstRequestTime: currentTime},
+			},
 		}
+		rateLimiter := RateLimiter{}
 
-		response := rateLimiter.ValidateRequestLimit(clientId, currentTime, mockedRateLimiterData)
+		response, err := rateLimiter.ValidateRequestLimit(clientId, currentTime, NewMemoryStore(mockedRateLimiterData))
+		if err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
 
 		if !response.Status {
 			t.Errorf("Expect validation to be %v, but got %v", expectedStatus, response.Status)
 		}
 
-		if response.Data != expectedData[clientId] {
+		if !reflect.DeepEqual(response.Data, expectedData[clientId]) {
 			t.Errorf("Expected data to be updated %v, but got %v", expectedData[clientId], response.Data)
 		}
 	})
@@ -148,30 +136,22 @@ func TestValidateRequestLimitSuccess(t *testing.T) {
 		expectedStatus := true
 		expectedData := map[string]RateLimiterData{
 			clientId: {
-				Requests:         mockedRateLimiterData[clientId].Requests + 1,
-				Limit:            mockedRateLimiterData[clientId].Limit,
-				Window:           mockedRateLimiterData[clientId].Window,
-				FirstRequestTime: mockedRateLimiterData[clientId].FirstRequestTime,
+				Policy: Policy{Limit: mockedRateLimiterData[clientId].Limit, Window: mockedRateLimiterData[clientId].Window},
+				Usage:  Usage{Requests: mockedRateLimiterData[clientId].Requests + 1, FirstRequestTime: mockedRateLimiterData[clientId].FirstRequestTime},
 			},
 		}
-		RateLimiterData := RateLimiterData{
-			Requests:         config.DefaultRequest,
-			Limit:            config.DefaultLimit,
-			Window:           config.DefaultWindow,
-			FirstRequestTime: currentTime,
-		}
-		rateLimiter := RateLimiter{
-			RateLimiterData: RateLimiterData,
-			Mutex:           sync.Mutex{},
-		}
+		rateLimiter := RateLimiter{}
 
-		response := rateLimiter.ValidateRequestLimit(clientId, currentTime, mockedRateLimiterData)
+		response, err := rateLimiter.ValidateRequestLimit(clientId, currentTime, NewMemoryStore(mockedRateLimiterData))
+		if err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
 
 		if !response.Status {
 			t.Errorf("Expect validation to be %v, but got %v", expectedStatus, response.Status)
 		}
 
-		if response.Data != expectedData[clientId] {
+		if !reflect.DeepEqual(response.Data, expectedData[clientId]) {
 			t.Errorf("Expected data to be updated %v, but got %v", expectedData[clientId], response.Data)
 		}
 	})
@@ -182,31 +162,114 @@ func TestValidateRequestLimitSuccess(t *testing.T) {
 		expectedStatus := true
 		expectedData := map[string]RateLimiterData{
 			clientId: {
-				Requests:         1,
-				Limit:            mockedRateLimiterData[clientId].Limit,
-				Window:           mockedRateLimiterData[clientId].Window,
-				FirstRequestTime: currentTime,
+				Policy: Policy{Limit: mockedRateLimiterData[clientId].Limit, Window: mockedRateLimiterData[clientId].Window},
+				Usage:  Usage{Requests: 1, FirstRequestTime: currentTime},
 			},
 		}
-		RateLimiterData := RateLimiterData{
-			Requests:         config.DefaultRequest,
-			Limit:            config.DefaultLimit,
-			Window:           config.DefaultWindow,
-			FirstRequestTime: currentTime,
-		}
-		rateLimiter := RateLimiter{
-			RateLimiterData: RateLimiterData,
-			Mutex:           sync.Mutex{},
-		}
+		rateLimiter := RateLimiter{}
 
-		response := rateLimiter.ValidateRequestLimit(clientId, currentTime, mockedRateLimiterData)
+		response, err := rateLimiter.ValidateRequestLimit(clientId, currentTime, NewMemoryStore(mockedRateLimiterData))
+		if err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
 
 		if !response.Status {
 			t.Errorf("Expect validation to be %v, but got %v", expectedStatus, response.Status)
 		}
 
-		if response.Data != expectedData[clientId] {
+		if !reflect.DeepEqual(response.Data, expectedData[clientId]) {
 			t.Errorf("Expected data to be updated %v, but got %v", expectedData[clientId], response.Data)
 		}
 	})
 }
+
+func TestInFlight(t *testing.T) {
+	acquire := func(rateLimiter *RateLimiter, clientId string, store Store) bool {
+		acquired, err := rateLimiter.AcquireInFlight(clientId, store)
+		if err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
+		return acquired
+	}
+
+	t.Run("acquire up to max in flight", func(t *testing.T) {
+		clientId := "PT In Flight"
+		store := NewMemoryStore(map[string]RateLimiterData{
+			clientId: {Policy: Policy{Limit: 3, Window: 5 * time.Second, MaxInFlight: 2}},
+		})
+		rateLimiter := RateLimiter{}
+
+		if !acquire(&rateLimiter, clientId, store) || !acquire(&rateLimiter, clientId, store) {
+			t.Fatalf("Expect first 2 requests to acquire a slot")
+		}
+
+		if acquire(&rateLimiter, clientId, store) {
+			t.Errorf("Expect third request to be rejected")
+		}
+
+		rateLimiter.ReleaseInFlight(clientId)
+		if !acquire(&rateLimiter, clientId, store) {
+			t.Errorf("Expect request to acquire the released slot")
+		}
+	})
+
+	t.Run("default max in flight is kept after the first request", func(t *testing.T) {
+		config.DefaultMaxInFlight = 1
+		defer func() { config.DefaultMaxInFlight = 0 }()
+		for _, store := range []Store{NewMemoryStore(nil), NewAtomicCounterStore(nil)} {
+			rateLimiter := RateLimiter{}
+			rateLimiter.ValidateRequestLimit("PT Default", time.Now(), store)
+
+			if !acquire(&rateLimiter, "PT Default", store) {
+				t.Fatalf("Expect first request to acquire a slot")
+			}
+			if acquire(&rateLimiter, "PT Default", store) {
+				t.Errorf("Expect second request to be rejected by the default max in flight of %v", 1)
+			}
+		}
+	})
+
+	t.Run("no limit by default", func(t *testing.T) {
+		rateLimiter := RateLimiter{}
+		store := NewMemoryStore(nil)
+
+		for i := 0; i < 10; i++ {
+			if !acquire(&rateLimiter, "PT New", store) {
+				t.Fatalf("Expect request %v to acquire a slot", i+1)
+			}
+		}
+	})
+}
+
+func TestUpdateRateLimiterData(t *testing.T) {
+	currentTime := time.Now()
+	current := NewRateLimiterData(CreateData{
+		Limit: 5, Window: 60,
+		Limits: []CreateData{{Limit: 100, Window: 3600}},
+	}, currentTime)
+	current.Requests = 3
+	current.Limits[0].Requests = 30
+
+	t.Run("usage is kept for the same algorithm", func(t *testing.T) {
+		response := UpdateRateLimiterData(current, CreateData{
+			Limit: 10, Window: 60, Algorithm: AlgorithmCounter,
+			Limits: []CreateData{{Limit: 200, Window: 3600}},
+		}, currentTime.Add(time.Second))
+
+		if response.Limit != 10 || response.Requests != 3 {
+			t.Errorf("Expect limit %v with %v requests, but got %v and %v", 10, 3, response.Limit, response.Requests)
+		}
+
+		if response.Limits[0].Limit != 200 || response.Limits[0].Requests != 30 {
+			t.Errorf("Expect additional limit %v with %v requests, but got %v and %v", 200, 30, response.Limits[0].Limit, response.Limits[0].Requests)
+		}
+	})
+
+	t.Run("usage is reset when the algorithm changes", func(t *testing.T) {
+		response := UpdateRateLimiterData(current, CreateData{Limit: 10, Window: 60, Algorithm: AlgorithmSlidingWindow}, currentTime)
+
+		if response.Requests != 0 || len(response.Limits) != 0 {
+			t.Errorf("Expect new usage without additional limits, but got %v", response)
+		}
+	})
+}
@@ -0,0 +1,330 @@
+package wal
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"rate_limiter/snapshot"
+	"rate_limiter/validator"
+	"sync"
+	"time"
+)
+
+// ErrCorrupt is returned by Replay when an entry in the middle of the log can not be decoded
+// The log is not changed, so it can be inspected before it is removed
+var ErrCorrupt = errors.New("wal: corrupt write-ahead log entry")
+
+// entry is a single line of the write-ahead log, containing the new data of a client after a config change or request
+// Each entry holds the whole data of the client rather than the change, so replaying an entry twice gives the same result
+type entry struct {
+	ClientID string                    `json:"client_id"`
+	Deleted  bool                      `json:"deleted,omitempty"`
+	Data     validator.RateLimiterData `json:"data"`
+}
+
+// Store writes every change of the wrapped store to an append-only log before it is acknowledged,
+// so changes made since the last snapshot are not lost if the process crashes
+// The log is meant for the in memory store, as it relies on the update being called once while the client is locked
+type Store struct {
+	validator.Store
+
+	// Changes hold the read lock, while compaction holds the write lock so no change happens between the snapshot and truncating the log
+	compactMutex sync.RWMutex
+
+	// Entries are queued while the client is still locked by the store, so entries of the same client are in the same order as the changes
+	// A single writer encodes and writes every queued entry at once, so the client is not locked while the log is written
+	queueMutex sync.Mutex
+	queue      *batch
+	closed     bool
+	wake       chan struct{}
+	stop       chan struct{}
+	stopped    chan struct{}
+
+	// Only used by the writer, so the lines of a batch are encoded without allocating a new buffer for every batch
+	buffer []byte
+
+	fileMutex sync.Mutex
+	file      *os.File
+}
+
+// batch is a group of entries written to the log in a single write
+type batch struct {
+	entries []entry
+	// Closed once the entries are written, with the error of the write in err
+	written chan struct{}
+	err     error
+}
+
+// Open opens the log file for appending, creating it if it does not exist, and starts the writer of the log until Close
+// Replay should be called before Open, so the existing log is applied to the store first
+func Open(store validator.Store, path string) (*Store, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{Store: store, file: file, wake: make(chan struct{}, 1), stop: make(chan struct{}), stopped: make(chan struct{})}
+	go s.write()
+	return s, nil
+}
+
+func (s *Store) Update(clientID string, update func(data validator.RateLimiterData, ok bool) validator.RateLimiterData) error {
+	s.compactMutex.RLock()
+	defer s.compactMutex.RUnlock()
+
+	// The entry is queued while the client is still locked by the store, and written once the client is unlocked
+	// When the store is able to tell which data it kept, only that data is written, under the client it was kept for
+	var queued *batch
+	var err error
+	if committer, ok := s.Store.(validator.CommitUpdater); ok {
+		err = committer.UpdateCommit(clientID, update, func(committedID string, data validator.RateLimiterData) {
+			queued = s.enqueue(entry{ClientID: committedID, Data: data})
+		})
+	} else {
+		err = s.Store.Update(clientID, func(data validator.RateLimiterData, ok bool) validator.RateLimiterData {
+			newData := update(data, ok)
+			queued = s.enqueue(entry{ClientID: clientID, Data: newData})
+			return newData
+		})
+	}
+	if err != nil {
+		return err
+	}
+	// Nothing is written when the store did not keep any data, for example when the client was rejected
+	if queued == nil {
+		return nil
+	}
+	return queued.wait()
+}
+
+func (s *Store) Delete(clientID string) error {
+	s.compactMutex.RLock()
+	defer s.compactMutex.RUnlock()
+
+	if err := s.Store.Delete(clientID); err != nil {
+		return err
+	}
+	return s.enqueue(entry{ClientID: clientID, Deleted: true}).wait()
+}
+
+// enqueue adds the entry to the next batch written by the writer, and returns that batch
+// It only holds the lock of the queue, so it is cheap enough to be called while the store holds the lock of the client
+// The data is encoded later by the writer, which is safe as the data of a client is replaced on every change rather than changed in place
+func (s *Store) enqueue(e entry) *batch {
+	s.queueMutex.Lock()
+	if s.closed {
+		s.queueMutex.Unlock()
+		b := &batch{written: make(chan struct{}), err: os.ErrClosed}
+		close(b.written)
+		return b
+	}
+	if s.queue == nil {
+		s.queue = &batch{written: make(chan struct{})}
+	}
+	b := s.queue
+	b.entries = append(b.entries, e)
+	s.queueMutex.Unlock()
+
+	// The writer only needs to be woken once for every entry queued while it was busy
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+	return b
+}
+
+// wait blocks until the entries of the batch are written
+func (b *batch) wait() error {
+	<-b.written
+	return b.err
+}
+
+// write writes the queued entries until the log is closed
+// Entries queued while a batch is written are grouped in the next batch, so concurrent changes share a single write
+func (s *Store) write() {
+	defer close(s.stopped)
+	for {
+		select {
+		case <-s.wake:
+			s.flush()
+		case <-s.stop:
+			s.flush()
+			return
+		}
+	}
+}
+
+// flush writes every queued entry
+func (s *Store) flush() {
+	s.queueMutex.Lock()
+	b := s.queue
+	s.queue = nil
+	s.queueMutex.Unlock()
+	if b == nil {
+		return
+	}
+
+	b.err = s.append(b.entries)
+	close(b.written)
+}
+
+// append writes the entries as one line each in a single write, so a crash can at most leave the last line incomplete
+// The write is not synced to disk, which is enough to survive a crash of the process but not of the machine, see Sync
+func (s *Store) append(entries []entry) error {
+	buffer := bytes.NewBuffer(s.buffer[:0])
+	encoder := json.NewEncoder(buffer)
+	var err error
+	for _, e := range entries {
+		// The encoder ends every entry with a newline, and an entry that can not be encoded is not written
+		length := buffer.Len()
+		if encodeErr := encoder.Encode(e); encodeErr != nil {
+			buffer.Truncate(length)
+			err = encodeErr
+		}
+	}
+	s.buffer = buffer.Bytes()
+
+	s.fileMutex.Lock()
+	defer s.fileMutex.Unlock()
+	if _, writeErr := s.file.Write(s.buffer); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
+
+// Sync flushes the log to disk
+func (s *Store) Sync() error {
+	s.fileMutex.Lock()
+	defer s.fileMutex.Unlock()
+	return s.file.Sync()
+}
+
+// Compact saves a snapshot of the store and empties the log, as every change in the log is now part of the snapshot
+func (s *Store) Compact(snapshotPath string, currentTime time.Time) error {
+	s.compactMutex.Lock()
+	defer s.compactMutex.Unlock()
+
+	if err := snapshot.Save(s.Store, snapshotPath, currentTime); err != nil {
+		return err
+	}
+
+	s.fileMutex.Lock()
+	defer s.fileMutex.Unlock()
+	// The file is opened with O_APPEND, so the next write starts at the new end of the file
+	return s.file.Truncate(0)
+}
+
+// Run syncs the log every sync interval and compacts it every compact interval until the context is done
+func (s *Store) Run(ctx context.Context, snapshotPath string, syncInterval time.Duration, compactInterval time.Duration) {
+	syncTicker := time.NewTicker(syncInterval)
+	defer syncTicker.Stop()
+	compactTicker := time.NewTicker(compactInterval)
+	defer compactTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-syncTicker.C:
+			if err := s.Sync(); err != nil {
+				log.Println("Error syncing write-ahead log:", err)
+			}
+		case <-compactTicker.C:
+			if err := s.Compact(snapshotPath, time.Now()); err != nil {
+				log.Println("Error compacting write-ahead log:", err)
+			}
+		}
+	}
+}
+
+// Close writes the queued entries and closes the log, changes made after Close return os.ErrClosed
+func (s *Store) Close() error {
+	s.queueMutex.Lock()
+	if s.closed {
+		s.queueMutex.Unlock()
+		return os.ErrClosed
+	}
+	s.closed = true
+	s.queueMutex.Unlock()
+	close(s.stop)
+	<-s.stopped
+
+	s.fileMutex.Lock()
+	defer s.fileMutex.Unlock()
+	return s.file.Close()
+}
+
+// Replay applies the entries of the log to the store in order, and returns the number of entries applied
+// It is called after the snapshot is restored, as the log only contains the changes made since that snapshot
+// Clients created from the default values that have expired by the end of the log are discarded, the same as when restoring a snapshot
+// A missing log is not an error. An incomplete last line left by a crash is removed from the file, so new entries
+// appended by Open do not join it. Any other entry that can not be decoded means the log is corrupt, and is returned as an error
+func Replay(store validator.Store, path string, currentTime time.Time) (int, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	replayed := 0
+	clients := map[string]bool{}
+	reader := bufio.NewReader(file)
+	// End of the last complete entry
+	var offset int64
+	for line := 1; ; line++ {
+		raw, err := reader.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			// Every entry is written with its newline in a single write, so only a crash during the write leaves a line without one
+			if len(raw) > 0 {
+				log.Printf("Removing incomplete write-ahead log entry at line %v\n", line)
+				if err := os.Truncate(path, offset); err != nil {
+					return replayed, err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return replayed, err
+		}
+
+		var e entry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return replayed, fmt.Errorf("%w at line %v: %v", ErrCorrupt, line, err)
+		}
+		offset += int64(len(raw))
+
+		if e.Deleted {
+			err = store.Delete(e.ClientID)
+		} else {
+			err = store.Update(e.ClientID, func(validator.RateLimiterData, bool) validator.RateLimiterData {
+				return e.Data
+			})
+		}
+		if err != nil {
+			return replayed, err
+		}
+		clients[e.ClientID] = true
+		replayed++
+	}
+
+	for clientID := range clients {
+		data, ok, err := store.Get(clientID)
+		if err != nil {
+			return replayed, err
+		}
+		if ok && !data.Configured && validator.IsExpired(data, currentTime) {
+			if err := store.Delete(clientID); err != nil {
+				return replayed, err
+			}
+		}
+	}
+	log.Printf("Replayed %v write-ahead log entries\n", replayed)
+	return replayed, nil
+}
@@ -0,0 +1,282 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"rate_limiter/snapshot"
+	"rate_limiter/validator"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func openTestStore(t *testing.T) (*Store, string) {
+	path := filepath.Join(t.TempDir(), "wal.log")
+	store, err := Open(validator.NewMemoryStore(nil), path)
+	if err != nil {
+		t.Fatalf("Expect no error, but got %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, path
+}
+
+func set(data validator.RateLimiterData) func(validator.RateLimiterData, bool) validator.RateLimiterData {
+	return func(validator.RateLimiterData, bool) validator.RateLimiterData {
+		return data
+	}
+}
+
+func TestReplay(t *testing.T) {
+	currentTime := time.Now()
+	configured := validator.NewRateLimiterData(validator.CreateData{Limit: 10, Window: 60}, currentTime)
+
+	t.Run("changes since the last snapshot are replayed", func(t *testing.T) {
+		store, path := openTestStore(t)
+		store.Update("PT Configured", set(configured))
+		store.Update("PT Active", set(validator.RateLimiterData{Policy: validator.Policy{Limit: 3, Window: 5 * time.Second}, Usage: validator.Usage{Requests: 2, FirstRequestTime: currentTime}}))
+		store.Update("PT Deleted", set(configured))
+		store.Delete("PT Deleted")
+
+		// Replay into a new store, as if the process crashed before any snapshot
+		recovered := validator.NewMemoryStore(nil)
+		replayed, err := Replay(recovered, path, currentTime.Add(time.Second))
+		if err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
+
+		if replayed != 4 {
+			t.Errorf("Expect replayed entries to be %v, but got %v", 4, replayed)
+		}
+
+		if data, ok, _ := recovered.Get("PT Configured"); !ok || data.Limit != 10 || !data.Configured {
+			t.Errorf("Expect configured client to be recovered, but got %v", data)
+		}
+
+		if data, ok, _ := recovered.Get("PT Active"); !ok || data.Requests != 2 {
+			t.Errorf("Expect request count to be recovered, but got %v", data)
+		}
+
+		if _, ok, _ := recovered.Get("PT Deleted"); ok {
+			t.Errorf("Expect deleted client to stay deleted")
+		}
+	})
+
+	t.Run("concurrent changes are replayed in the order they were made", func(t *testing.T) {
+		store, path := openTestStore(t)
+		rateLimiter := validator.RateLimiter{}
+		store.Update("PT Concurrent", set(configured))
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				rateLimiter.ValidateRequestLimit("PT Concurrent", currentTime, store)
+			}()
+		}
+		wg.Wait()
+
+		recovered := validator.NewMemoryStore(nil)
+		if _, err := Replay(recovered, path, currentTime); err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
+
+		if data, _, _ := recovered.Get("PT Concurrent"); data.Requests != 8 {
+			t.Errorf("Expect request count to be %v, but got %v", 8, data.Requests)
+		}
+	})
+
+	t.Run("changes after Close are rejected", func(t *testing.T) {
+		store, _ := openTestStore(t)
+		store.Close()
+
+		if err := store.Update("PT Closed", set(configured)); !errors.Is(err, os.ErrClosed) {
+			t.Errorf("Expect error to be %v, but got %v", os.ErrClosed, err)
+		}
+	})
+
+	t.Run("expired clients are discarded", func(t *testing.T) {
+		store, path := openTestStore(t)
+		store.Update("PT Expired", set(validator.RateLimiterData{Policy: validator.Policy{Limit: 3, Window: 5 * time.Second}, Usage: validator.Usage{Requests: 3, FirstRequestTime: currentTime}}))
+
+		recovered := validator.NewMemoryStore(nil)
+		if _, err := Replay(recovered, path, currentTime.Add(time.Minute)); err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
+
+		if _, ok, _ := recovered.Get("PT Expired"); ok {
+			t.Errorf("Expect expired client to be discarded")
+		}
+	})
+
+	t.Run("incomplete last entry is ignored", func(t *testing.T) {
+		store, path := openTestStore(t)
+		store.Update("PT Configured", set(configured))
+		store.file.WriteString(`{"client_id":"PT Partial","data":{"Requ`)
+
+		recovered := validator.NewMemoryStore(nil)
+		replayed, err := Replay(recovered, path, currentTime)
+		if err != nil || replayed != 1 {
+			t.Errorf("Expect %v entry to be replayed without error, but got %v and %v", 1, replayed, err)
+		}
+	})
+
+	t.Run("entries appended after an incomplete entry are replayed", func(t *testing.T) {
+		store, path := openTestStore(t)
+		store.Update("PT Configured", set(configured))
+		store.file.WriteString(`{"client_id":"PT Partial","data":{"Requ`)
+		store.Close()
+
+		// Restart after the crash, then make new changes
+		if _, err := Replay(validator.NewMemoryStore(nil), path, currentTime); err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
+		store, err := Open(validator.NewMemoryStore(nil), path)
+		if err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
+		defer store.Close()
+		store.Update("PT After A", set(configured))
+		store.Update("PT After B", set(configured))
+
+		recovered := validator.NewMemoryStore(nil)
+		replayed, err := Replay(recovered, path, currentTime)
+		if err != nil || replayed != 3 {
+			t.Errorf("Expect %v entries to be replayed without error, but got %v and %v", 3, replayed, err)
+		}
+		if _, ok, _ := recovered.Get("PT After B"); !ok {
+			t.Errorf("Expect client added after the crash to be recovered")
+		}
+	})
+
+	t.Run("corrupt entry in the middle of the log", func(t *testing.T) {
+		store, path := openTestStore(t)
+		store.Update("PT Configured", set(configured))
+		store.file.WriteString("not an entry\n")
+		store.Update("PT After", set(configured))
+
+		replayed, err := Replay(validator.NewMemoryStore(nil), path, currentTime)
+		if !errors.Is(err, ErrCorrupt) || replayed != 1 {
+			t.Errorf("Expect %v after %v entry, but got %v after %v", ErrCorrupt, 1, err, replayed)
+		}
+	})
+
+	t.Run("only data kept by the store is logged", func(t *testing.T) {
+		for _, policy := range []string{validator.MaxClientsPolicyReject, validator.MaxClientsPolicyOverflow} {
+			path := filepath.Join(t.TempDir(), "wal.log")
+			store, err := Open(validator.NewBoundedMemoryStore(nil, 1, 1, policy), path)
+			if err != nil {
+				t.Fatalf("Expect no error, but got %v", err)
+			}
+			defer store.Close()
+
+			active := validator.RateLimiterData{Policy: validator.Policy{Limit: 3, Window: 5 * time.Second}, Usage: validator.Usage{Requests: 1, FirstRequestTime: currentTime}}
+			store.Update("PT Active", set(active))
+			store.Update("PT New", set(active))
+
+			recovered := validator.NewMemoryStore(nil)
+			if _, err := Replay(recovered, path, currentTime); err != nil {
+				t.Fatalf("Expect no error, but got %v", err)
+			}
+
+			if _, ok, _ := recovered.Get("PT New"); ok {
+				t.Errorf("Expect client discarded by the %v policy not to be logged", policy)
+			}
+
+			_, ok, _ := recovered.Get(validator.OverflowClientID)
+			if ok != (policy == validator.MaxClientsPolicyOverflow) {
+				t.Errorf("Expect overflow bucket to be logged to be %v with the %v policy, but got %v", policy == validator.MaxClientsPolicyOverflow, policy, ok)
+			}
+		}
+	})
+
+	t.Run("missing log", func(t *testing.T) {
+		replayed, err := Replay(validator.NewMemoryStore(nil), filepath.Join(t.TempDir(), "missing.log"), currentTime)
+		if err != nil || replayed != 0 {
+			t.Errorf("Expect nothing to be replayed without error, but got %v and %v", replayed, err)
+		}
+	})
+}
+
+func TestCompact(t *testing.T) {
+	currentTime := time.Now()
+	configured := validator.NewRateLimiterData(validator.CreateData{Limit: 10, Window: 60}, currentTime)
+	store, path := openTestStore(t)
+	snapshotPath := filepath.Join(t.TempDir(), "snapshot.json")
+
+	store.Update("PT Configured", set(configured))
+	if err := store.Compact(snapshotPath, currentTime); err != nil {
+		t.Fatalf("Expect no error, but got %v", err)
+	}
+	store.Update("PT Active", set(validator.RateLimiterData{Policy: validator.Policy{Limit: 3, Window: 5 * time.Second}, Usage: validator.Usage{Requests: 2, FirstRequestTime: currentTime}}))
+
+	t.Run("log only contains changes after the snapshot", func(t *testing.T) {
+		replayed, err := Replay(validator.NewMemoryStore(nil), path, currentTime)
+		if err != nil || replayed != 1 {
+			t.Errorf("Expect %v entry to be replayed without error, but got %v and %v", 1, replayed, err)
+		}
+	})
+
+	t.Run("snapshot and log together recover every client", func(t *testing.T) {
+		recovered := validator.NewMemoryStore(nil)
+		if _, err := snapshot.Restore(recovered, snapshotPath, currentTime); err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
+		if _, err := Replay(recovered, path, currentTime); err != nil {
+			t.Fatalf("Expect no error, but got %v", err)
+		}
+
+		list, _ := recovered.List()
+		if len(list) != 2 {
+			t.Errorf("Expect %v clients to be recovered, but got %v", 2, list)
+		}
+	})
+
+	t.Run("log file is kept after compaction", func(t *testing.T) {
+		if _, err := os.Stat(path); err != nil {
+			t.Errorf("Expect log file to exist, but got %v", err)
+		}
+	})
+}
+
+// Benchmarks the default configuration, where every request goes through the write-ahead log of the in memory store
+// The same as BenchmarkValidateRequestLimit of the validator package, which benchmarks the in memory store on its own
+func BenchmarkValidateRequestLimit(b *testing.B) {
+	for _, useLog := range []bool{false, true} {
+		b.Run(fmt.Sprintf("write-ahead log %v", useLog), func(b *testing.B) {
+			var store validator.Store = validator.NewMemoryStore(nil)
+			if useLog {
+				walStore, err := Open(store, filepath.Join(b.TempDir(), "wal.log"))
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer walStore.Close()
+				store = walStore
+			}
+			rateLimiter := validator.RateLimiter{}
+			var clients atomic.Int64
+			currentTime := time.Now()
+
+			b.RunParallel(func(pb *testing.PB) {
+				// Each goroutine uses its own clients so they only contend on the shard locks and the log
+				// The limit is high enough that every request is allowed
+				clientIDs := make([]string, 16)
+				for i := range clientIDs {
+					clientIDs[i] = fmt.Sprintf("PT %v", clients.Add(1))
+					store.Update(clientIDs[i], set(validator.RateLimiterData{
+						Policy: validator.Policy{Limit: math.MaxInt, Window: time.Hour},
+						Usage:  validator.Usage{FirstRequestTime: currentTime},
+					}))
+				}
+				i := 0
+				for pb.Next() {
+					rateLimiter.ValidateRequestLimit(clientIDs[i%len(clientIDs)], currentTime, store)
+					i++
+				}
+			})
+		})
+	}
+}